@@ -6,11 +6,19 @@ Alpine.store('format', 'atom')
 
 /**
  * @param {String} baseUrl
+ * @param {String} kind
  * @param {bool} useInput
  */
-Alpine.data('container', (baseUrl, useInput) => ({
+Alpine.data('container', (baseUrl, kind, useInput) => ({
 	base: baseUrl,
+	kind: kind,
 	useInput: useInput,
+	init() {
+		const reset = () => this.short = ''
+		this.$watch('input', reset)
+		this.$watch('filter', reset)
+		this.$watch('$store.format', reset)
+	},
 	output() {
 		let url = `${window.location.origin}/${this.base}`
 		if (this.useInput) {
@@ -27,8 +35,86 @@ Alpine.data('container', (baseUrl, useInput) => ({
 		}
 		return url
 	},
+	async save() {
+		let definition = {
+			provider: this.base.split('/')[0],
+			kind: this.kind,
+			format: this.$store.format,
+		}
+		if (this.useInput) {
+			definition.slugs = this.input.split('/')
+		}
+		if (this.filter !== "") {
+			definition.filters = { filter: this.filter }
+		}
+		const response = await fetch('/f', {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify(definition),
+		})
+		if (!response.ok) {
+			throw new Error(await response.text())
+		}
+		const saved = await response.json()
+		this.short = `${window.location.origin}${saved.url}`
+	},
+	/**
+	 * @param {String} type
+	 */
+	async suggest(type) {
+		const query = this.input.replaceAll('-', ' ').trim()
+		if (query.length < 3) {
+			this.suggestions = []
+			return
+		}
+		const provider = this.base.split('/')[0]
+		const params = new URLSearchParams({ type: type, q: query })
+		const response = await fetch(`/${provider}/search?${params.toString()}`)
+		// keep the previous suggestions if rate limited, or the input has
+		// changed while waiting
+		if (!response.ok || query !== this.input.replaceAll('-', ' ').trim()) {
+			return
+		}
+		const data = await response.json()
+		this.suggestions = data.results
+	},
 	input: '',
 	filter: '',
+	short: '',
+	suggestions: [],
+}))
+
+Alpine.data('importer', () => ({
+	async upload(form) {
+		this.loading = true
+		this.error = ''
+		this.result = null
+		const data = new FormData(form)
+		data.set('format', this.$store.format)
+		try {
+			const response = await fetch(window.location.pathname, {
+				method: 'POST',
+				body: data,
+			})
+			if (!response.ok) {
+				throw new Error(await response.text())
+			}
+			this.result = await response.json()
+		} catch (e) {
+			this.error = e.message
+		} finally {
+			this.loading = false
+		}
+	},
+	output() {
+		if (this.result === null) {
+			return ''
+		}
+		return `${window.location.origin}${this.result.url}`
+	},
+	loading: false,
+	error: '',
+	result: null,
 }))
 
 Alpine.start()
@@ -1,16 +1,20 @@
 package config
 
 import (
+	"net"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog"
 )
 
 type config struct {
-	Port int `default:"8080" envconfig:"PORT"`
-	Log  struct {
+	Port      int    `default:"8080" envconfig:"PORT"`
+	PublicUrl string `envconfig:"PUBLIC_URL"`
+	Log       struct {
 		Level    string `default:"debug" envconfig:"LOG_LEVEL"`
 		Format   string `default:"text"  envconfig:"LOG_FORMAT"`
 		Requests bool   `default:"false" envconfig:"LOG_REQUESTS"`
@@ -19,7 +23,25 @@ type config struct {
 		Hardcover string `envconfig:"HARDCOVER_TOKEN"`
 	}
 	Cache struct {
-		StoragePath string `default:"." envconfig:"CACHE_STORAGE_PATH"`
+		StoragePath     string        `default:"."   envconfig:"CACHE_STORAGE_PATH"`
+		RefreshInterval time.Duration `default:"30m" envconfig:"CACHE_REFRESH_INTERVAL"`
+		Store           string        `envconfig:"CACHE_STORE"`
+	}
+	Feed struct {
+		HistoryDepth int `default:"25" envconfig:"FEED_HISTORY_DEPTH"`
+	}
+	Webhook struct {
+		Interval time.Duration `default:"15m" envconfig:"WEBHOOK_INTERVAL"`
+	}
+	WebSub struct {
+		Hub string `envconfig:"WEBSUB_HUB"`
+	}
+	Smtp struct {
+		Host     string `envconfig:"SMTP_HOST"`
+		Port     int    `default:"587" envconfig:"SMTP_PORT"`
+		Username string `envconfig:"SMTP_USERNAME"`
+		Password string `envconfig:"SMTP_PASSWORD"`
+		From     string `envconfig:"SMTP_FROM"`
 	}
 }
 
@@ -41,6 +63,14 @@ func Port() int {
 	return cfg.Port
 }
 
+// PublicUrl is the url the server is reachable at, used for links back to
+// feeds. When empty, the host of each request is used instead, and email
+// digests and WebSub publishing are disabled as their links can't come from
+// a request
+func PublicUrl() string {
+	return cfg.PublicUrl
+}
+
 func LogLevel() zerolog.Level {
 	switch strings.ToLower(cfg.Log.Level) {
 	case "trace":
@@ -80,3 +110,56 @@ func HardcoverToken() string {
 func CacheStorage() string {
 	return cfg.Cache.StoragePath
 }
+
+// CacheStore is where collections and users are kept besides memory, either
+// "memory", "disk" or a redis:// url. When empty, they're only kept in memory
+func CacheStore() string {
+	return cfg.Cache.Store
+}
+
+// CacheRefreshInterval is how often popular feeds are checked for data that's
+// about to expire, so it can be reloaded before anyone has to wait for it
+func CacheRefreshInterval() time.Duration {
+	// data expires after 12 hours, so refreshing it less often than this
+	// would reload it on every run
+	return min(max(cfg.Cache.RefreshInterval, time.Minute), 3*time.Hour)
+}
+
+func FeedHistoryDepth() int {
+	if cfg.Feed.HistoryDepth <= 0 {
+		return 25
+	}
+	return cfg.Feed.HistoryDepth
+}
+
+func WebhookInterval() time.Duration {
+	if cfg.Webhook.Interval < time.Minute {
+		return time.Minute
+	}
+	return cfg.Webhook.Interval
+}
+
+func WebSubHub() string {
+	return cfg.WebSub.Hub
+}
+
+// SmtpAddr is the host:port of the SMTP server for email digests, or empty
+// when digests are disabled
+func SmtpAddr() string {
+	if cfg.Smtp.Host == "" || cfg.Smtp.From == "" {
+		return ""
+	}
+	return net.JoinHostPort(cfg.Smtp.Host, strconv.Itoa(cfg.Smtp.Port))
+}
+
+func SmtpUsername() string {
+	return cfg.Smtp.Username
+}
+
+func SmtpPassword() string {
+	return cfg.Smtp.Password
+}
+
+func SmtpFrom() string {
+	return cfg.Smtp.From
+}
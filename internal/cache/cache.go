@@ -1,75 +1,140 @@
 package cache
 
 import (
-	"errors"
-	"os"
-	"path"
+	"sync"
 	"time"
 
-	"github.com/RobBrazier/bookfeed/config"
 	"github.com/RobBrazier/bookfeed/internal/model"
 	"github.com/maypok86/otter/v2"
 	"github.com/rs/zerolog/log"
 )
 
 var (
-	CollectionCache *otter.Cache[string, model.Collection]
-	UserCache       *otter.Cache[string, model.UserInterests]
+	DefinitionCache *otter.Cache[string, model.FeedDefinition]
+	WebhookCache    *otter.Cache[string, model.Webhook]
+	DigestCache     *otter.Cache[string, model.Digest]
+
+	// saveMu prevents scheduled and write-through saves of the same file
+	// from overlapping
+	saveMu sync.Mutex
 )
 
 type (
 	CollectionLoaderFunc     = otter.LoaderFunc[string, model.Collection]
 	BulkCollectionLoaderFunc = otter.BulkLoaderFunc[string, model.Collection]
 	UserLoaderFunc           = otter.LoaderFunc[string, model.UserInterests]
+	BulkUserLoaderFunc       = otter.BulkLoaderFunc[string, model.UserInterests]
+	SearchLoaderFunc         = otter.LoaderFunc[string, []model.SearchResult]
 )
 
 func init() {
-	CollectionCache = newCollectionCache()
-	UserCache = newUserCache()
+	DefinitionCache = newDefinitionCache()
+	WebhookCache = newWebhookCache()
+	DigestCache = newDigestCache()
 }
 
+// Caches hold the data a builder loads from its provider. Each builder can
+// be given its own, or they can be shared
+type Caches struct {
+	Collections *otter.Cache[string, model.Collection]
+	// Stale keeps the last collection successfully loaded for each key, long
+	// after it's expired from Collections, to serve when the provider is down
+	Stale *otter.Cache[string, model.Collection]
+	Users *otter.Cache[string, model.UserInterests]
+	// StaleUsers keeps the last interests successfully loaded for each user,
+	// like Stale does for collections
+	StaleUsers *otter.Cache[string, model.UserInterests]
+	Search     *otter.Cache[string, []model.SearchResult]
+	// History keeps the entries previously included in each feed, so they
+	// stay in it after they drop out of the release window
+	History *otter.Cache[string, model.History]
+	// HistoryDepth is how many entries each feed keeps in its history
+	HistoryDepth int
+
+	// store is nil when collections and users are only kept in memory
+	store               Store
+	collectionRefresher *refresher[model.Collection]
+	userRefresher       *refresher[model.UserInterests]
+}
+
+// NewCaches creates empty caches, backed by the store if it isn't nil
+func NewCaches(store Store) *Caches {
+	c := &Caches{
+		Collections:  newCollectionCache(),
+		Stale:        newStaleCache[model.Collection](),
+		Users:        newUserCache(),
+		StaleUsers:   newStaleCache[model.UserInterests](),
+		Search:       newSearchCache(),
+		History:      newHistoryCache(),
+		HistoryDepth: defaultHistoryDepth,
+		store:        store,
+	}
+	c.collectionRefresher = newRefresher(c.Collections)
+	c.collectionRefresher.grew = gainedBooks
+	c.userRefresher = newRefresher(c.Users)
+	return c
+}
+
+// Close closes the store behind the caches
+func (c *Caches) Close() {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Close(); err != nil {
+		log.Error().Err(err).Msg("Unable to close cache store")
+	}
+}
+
+const (
+	collectionExpiry = 12 * time.Hour
+	userExpiry       = 24 * time.Hour
+	// refreshLead is how long before expiry collections and users are
+	// reloaded when they're requested
+	refreshLead = time.Hour
+	// defaultHistoryDepth matches the default FEED_HISTORY_DEPTH
+	defaultHistoryDepth = 25
+)
+
+// Collections and users are reloaded in the background shortly before they
+// expire, and the previous value is served while that happens. Expiry is
+// reset when they're reloaded
 func newCollectionCache() *otter.Cache[string, model.Collection] {
 	return otter.Must(&otter.Options[string, model.Collection]{
-		MaximumSize:      10_000,
-		ExpiryCalculator: otter.ExpiryCreating[string, model.Collection](12 * time.Hour),
+		MaximumSize:       10_000,
+		ExpiryCalculator:  otter.ExpiryWriting[string, model.Collection](collectionExpiry),
+		RefreshCalculator: otter.RefreshWriting[string, model.Collection](collectionExpiry - refreshLead),
 	})
 }
 
 func newUserCache() *otter.Cache[string, model.UserInterests] {
 	return otter.Must(&otter.Options[string, model.UserInterests]{
-		MaximumSize:      10_000,
-		ExpiryCalculator: otter.ExpiryCreating[string, model.UserInterests](24 * time.Hour),
+		MaximumSize:       10_000,
+		ExpiryCalculator:  otter.ExpiryWriting[string, model.UserInterests](userExpiry),
+		RefreshCalculator: otter.RefreshWriting[string, model.UserInterests](userExpiry - refreshLead),
 	})
 }
 
-func LoadCache() {
-	cachePath := config.CacheStorage()
-	collectionPath := path.Join(cachePath, "collection.gob")
-	userPath := path.Join(cachePath, "user.gob")
-	log.Info().Str("path", collectionPath).Msg("Loading collection cache")
-	if err := otter.LoadCacheFromFile(CollectionCache, collectionPath); err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			log.Error().Err(err).Msg("Load cache failed")
-		}
-	}
-	log.Info().Str("path", userPath).Msg("Loading user cache")
-	if err := otter.LoadCacheFromFile(UserCache, userPath); err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			log.Error().Err(err).Msg("Load cache failed")
-		}
-	}
+// LoadCache loads the snapshots of the caches, and of the provider caches
+// given, which should be the same as those passed to SaveCache. Provider data
+// can be loaded again, but feed history, saved feeds and subscriptions can't
+func LoadCache(caches *Caches) {
+	loadCache(caches.Collections, "collection", false)
+	loadCache(caches.Stale, "stale", false)
+	loadCache(caches.Users, "user", false)
+	loadCache(caches.StaleUsers, "staleuser", false)
+	loadCache(caches.History, "history", true)
+	loadDefinitions()
+	loadCache(WebhookCache, "webhook", true)
+	loadCache(DigestCache, "digest", true)
 }
 
-func SaveCache() {
-	cachePath := config.CacheStorage()
-	collectionPath := path.Join(cachePath, "collection.gob")
-	userPath := path.Join(cachePath, "user.gob")
-	log.Info().Str("path", collectionPath).Msg("Saving collection cache")
-	if err := otter.SaveCacheToFile(CollectionCache, collectionPath); err != nil {
-		log.Error().Err(err).Msg("Save cache failed")
-	}
-	log.Info().Str("path", userPath).Msg("Saving user cache")
-	if err := otter.SaveCacheToFile(UserCache, userPath); err != nil {
-		log.Error().Err(err).Msg("Save cache failed")
-	}
+func SaveCache(caches *Caches) {
+	saveCache(caches.Collections, "collection")
+	saveCache(caches.Stale, "stale")
+	saveCache(caches.Users, "user")
+	saveCache(caches.StaleUsers, "staleuser")
+	saveCache(caches.History, "history")
+	saveDefinitions()
+	saveCache(WebhookCache, "webhook")
+	saveCache(DigestCache, "digest")
 }
@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/maypok86/otter/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// maxDefinitions limits how many feeds can be saved. Saved feeds can't be
+// rebuilt, so rather than evicting them to make room, new ones are refused
+const maxDefinitions = 100_000
+
+var ErrDefinitionLimit = errors.New("saved feed limit reached")
+
+// journalMu orders appends to the definition journal with the snapshots that
+// replace it
+var journalMu sync.Mutex
+
+func newDefinitionCache() *otter.Cache[string, model.FeedDefinition] {
+	return otter.Must(&otter.Options[string, model.FeedDefinition]{
+		// forget saved feeds that nobody has requested for a year
+		ExpiryCalculator: otter.ExpiryAccessing[string, model.FeedDefinition](365 * 24 * time.Hour),
+	})
+}
+
+// normaliseDefinition drops empty slugs and filters, which are lost when a
+// definition is written to a snapshot or the journal, so a definition saved
+// again matches the one read back
+func normaliseDefinition(definition model.FeedDefinition) model.FeedDefinition {
+	if len(definition.Slugs) == 0 {
+		definition.Slugs = nil
+	}
+	if len(definition.Filters) == 0 {
+		definition.Filters = nil
+	}
+	return definition
+}
+
+// definitionId derives a short id from the canonical encoding of a definition,
+// so saving the same feed twice returns the same link
+func definitionId(encoded []byte) string {
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:6])
+}
+
+// SaveDefinition stores a feed definition and returns its id. Definitions are
+// written to disk straight away, as unlike the other caches they can't be
+// rebuilt from Hardcover
+func SaveDefinition(definition model.FeedDefinition) (string, error) {
+	definition = normaliseDefinition(definition)
+	// JSON is canonical here, as map keys are encoded in order
+	encoded, err := json.Marshal(definition)
+	if err != nil {
+		return "", err
+	}
+	id := definitionId(encoded)
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	existing, found := DefinitionCache.GetIfPresent(id)
+	if found {
+		existingEncoded, err := json.Marshal(normaliseDefinition(existing))
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(existingEncoded, encoded) {
+			return "", fmt.Errorf("feed id %s is already in use", id)
+		}
+		return id, nil
+	}
+	if DefinitionCache.EstimatedSize() >= maxDefinitions {
+		return "", ErrDefinitionLimit
+	}
+	if err := appendJournal(journalRecord{Id: id, Definition: definition}); err != nil {
+		return "", err
+	}
+	DefinitionCache.Set(id, definition)
+	return id, nil
+}
+
+// GetDefinition returns the saved feed definition for an id
+func GetDefinition(id string) (model.FeedDefinition, bool) {
+	return DefinitionCache.GetIfPresent(id)
+}
+
+// journalRecord is a line of the definition journal, which definitions are
+// appended to as they're saved, rather than rewriting the whole snapshot
+type journalRecord struct {
+	Id         string               `json:"id"`
+	Definition model.FeedDefinition `json:"definition"`
+}
+
+func journalPath() string {
+	return path.Join(config.CacheStorage(), "definition.journal")
+}
+
+func appendJournal(record journalRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(config.CacheStorage(), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(journalPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// loadDefinitions loads the definition snapshot, then the definitions saved
+// since it was written
+func loadDefinitions() {
+	loadCache(DefinitionCache, "definition", true)
+	file, err := os.Open(journalPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to open definition journal")
+		return
+	}
+	defer file.Close()
+	replayed := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var record journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// the last line may be incomplete if the process stopped mid-write
+			log.Warn().Err(err).Msg("Skipping unreadable definition journal record")
+			continue
+		}
+		DefinitionCache.Set(record.Id, record.Definition)
+		replayed++
+	}
+	if err := scanner.Err(); err != nil {
+		log.Error().Err(err).Msg("Unable to read definition journal")
+	}
+	log.Info().Int("entries", replayed).Msg("Replayed definition journal")
+}
+
+// saveDefinitions writes the definition snapshot, then empties the journal
+// as everything in it is now in the snapshot
+func saveDefinitions() {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := saveCache(DefinitionCache, "definition"); err != nil {
+		return
+	}
+	if err := os.Remove(journalPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error().Err(err).Msg("Unable to clear definition journal")
+	}
+}
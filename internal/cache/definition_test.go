@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/RobBrazier/bookfeed/internal/model"
+)
+
+// useDefinitionStorage gives the test its own saved feeds, stored in a
+// temporary directory
+func useDefinitionStorage(t *testing.T) {
+	t.Helper()
+	t.Setenv("CACHE_STORAGE_PATH", t.TempDir())
+	if err := config.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	previous := DefinitionCache
+	DefinitionCache = newDefinitionCache()
+	t.Cleanup(func() { DefinitionCache = previous })
+}
+
+func TestSaveDefinitionAfterRestart(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition model.FeedDefinition
+	}{
+		{
+			name: "empty filters",
+			definition: model.FeedDefinition{
+				Provider: "hc",
+				Kind:     "author",
+				Slugs:    []string{"brandon-sanderson"},
+				Filters:  map[string]string{},
+			},
+		},
+		{
+			name: "empty slugs",
+			definition: model.FeedDefinition{
+				Provider: "hc",
+				Kind:     "mix",
+				Slugs:    []string{},
+				Filters:  map[string]string{"author": "robin-hobb"},
+			},
+		},
+		{
+			name: "filters",
+			definition: model.FeedDefinition{
+				Provider: "hc",
+				Kind:     "mix",
+				Filters:  map[string]string{"author": "robin-hobb", "series": "farseer"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useDefinitionStorage(t)
+			id, err := SaveDefinition(test.definition)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the definition is read back from the journal after a restart
+			DefinitionCache = newDefinitionCache()
+			loadDefinitions()
+			if _, ok := GetDefinition(id); !ok {
+				t.Fatalf("expected %s to be loaded from the journal", id)
+			}
+
+			again, err := SaveDefinition(test.definition)
+			if err != nil {
+				t.Fatalf("expected saving the same feed again to succeed, got %v", err)
+			}
+			if again != id {
+				t.Errorf("expected the same id %s, got %s", id, again)
+			}
+		})
+	}
+}
+
+func TestSaveDefinitionEmptyCollections(t *testing.T) {
+	useDefinitionStorage(t)
+	empty, err := SaveDefinition(model.FeedDefinition{
+		Provider: "hc",
+		Kind:     "recent",
+		Slugs:    []string{},
+		Filters:  map[string]string{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := SaveDefinition(model.FeedDefinition{Provider: "hc", Kind: "recent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty != missing {
+		t.Errorf("expected empty and missing slugs and filters to share an id, got %s and %s",
+			empty, missing)
+	}
+}
+
+func TestSaveDefinitionCollision(t *testing.T) {
+	useDefinitionStorage(t)
+	definition := model.FeedDefinition{Provider: "hc", Kind: "author", Slugs: []string{"a"}}
+	id, err := SaveDefinition(definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another definition somehow stored under the same id
+	DefinitionCache.Set(id, model.FeedDefinition{Provider: "hc", Kind: "series"})
+	if _, err := SaveDefinition(definition); err == nil {
+		t.Error("expected a different definition with the same id to be refused")
+	}
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"iter"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/maypok86/otter/v2"
+)
+
+func newDigestCache() *otter.Cache[string, model.Digest] {
+	// subscriptions are never evicted, the number of digests is limited when
+	// they're registered and unconfirmed ones are removed by ExpireDigests
+	return otter.Must(&otter.Options[string, model.Digest]{})
+}
+
+// SaveDigest stores a digest, writing it to disk straight away so
+// subscriptions aren't lost on restart
+func SaveDigest(id string, digest model.Digest) {
+	DigestCache.Set(id, digest)
+	saveCache(DigestCache, "digest")
+}
+
+// DeleteDigest removes a digest, writing the change to disk
+func DeleteDigest(id string) {
+	if _, ok := DigestCache.Invalidate(id); ok {
+		saveCache(DigestCache, "digest")
+	}
+}
+
+func GetDigest(id string) (model.Digest, bool) {
+	return DigestCache.GetIfPresent(id)
+}
+
+// ExpireDigests removes the digests that weren't confirmed before the cutoff,
+// writing the change to disk
+func ExpireDigests(cutoff time.Time) int {
+	expired := 0
+	for id, digest := range DigestCache.All() {
+		if !digest.Confirmed && digest.Created.Before(cutoff) {
+			DigestCache.Invalidate(id)
+			expired++
+		}
+	}
+	if expired > 0 {
+		saveCache(DigestCache, "digest")
+	}
+	return expired
+}
+
+// Digests iterates over every registered digest
+func Digests() iter.Seq2[string, model.Digest] {
+	return DigestCache.All()
+}
+
+// UpdateDigests replaces the stored state of digests after sending, then
+// writes them to disk. Digests deleted since sending started stay deleted
+func UpdateDigests(digests map[string]model.Digest) {
+	for id, digest := range digests {
+		DigestCache.Compute(
+			id,
+			func(_ model.Digest, found bool) (model.Digest, otter.ComputeOp) {
+				if !found {
+					return digest, otter.CancelOp
+				}
+				return digest, otter.WriteOp
+			},
+		)
+	}
+	saveCache(DigestCache, "digest")
+}
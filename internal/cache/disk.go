@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DiskStore is a Store that writes each entry to its own file as soon as
+// it's set, so nothing is lost if the process stops. Files start with when
+// the entry expires, as a unix timestamp in nanoseconds
+type DiskStore struct {
+	dir string
+	// stop ends pruning, and done is closed once it has
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// diskPruneInterval is how often expired entries are removed, as entries
+// that are never read again would otherwise stay on disk
+const diskPruneInterval = time.Hour
+
+// NewDiskStore opens a store in dir, creating it if needed, and removes any
+// entries that expired while it was closed, then prunes it regularly until
+// it's closed
+func NewDiskStore(dir string) (*DiskStore, error) {
+	return newDiskStore(dir, diskPruneInterval)
+}
+
+func newDiskStore(dir string, interval time.Duration) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &DiskStore{dir: dir, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.pruneEvery(interval)
+	return s, nil
+}
+
+func (s *DiskStore) pruneEvery(interval time.Duration) {
+	defer close(s.done)
+	s.prune()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.prune()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// path spreads entries across subdirectories named after the start of the
+// hashed key, to keep directories small
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+func (s *DiskStore) Get(ctx context.Context, key string) ([]byte, error) {
+	filename := s.path(key)
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotStored
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 || !time.Now().Before(diskExpiry(data)) {
+		_ = os.Remove(filename)
+		return nil, ErrNotStored
+	}
+	return data[8:], nil
+}
+
+func diskExpiry(data []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(data[:8])))
+}
+
+func (s *DiskStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return writeAtomic(s.path(key), func(w io.Writer) error {
+		header := binary.BigEndian.AppendUint64(nil, uint64(time.Now().Add(ttl).UnixNano()))
+		_, err := w.Write(append(header, value...))
+		return err
+	})
+}
+
+func (s *DiskStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Close stops pruning, waiting for a prune that's running to finish
+func (s *DiskStore) Close() error {
+	if s.stop == nil {
+		return nil
+	}
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return nil
+}
+
+// prune removes expired entries, along with temporary files left by writes
+// that didn't finish
+func (s *DiskStore) prune() {
+	now := time.Now()
+	removed := 0
+	err := filepath.WalkDir(s.dir, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		var expired bool
+		if filepath.Base(filename)[0] == '.' {
+			// leave files that could still be being written
+			info, err := entry.Info()
+			expired = err == nil && now.Sub(info.ModTime()) > time.Minute
+		} else {
+			file, err := os.Open(filename)
+			if err != nil {
+				return nil
+			}
+			header := make([]byte, 8)
+			_, err = io.ReadFull(file, header)
+			_ = file.Close()
+			expired = err != nil || !now.Before(diskExpiry(header))
+		}
+		if expired && os.Remove(filename) == nil {
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("path", s.dir).Msg("Unable to prune cache store")
+		return
+	}
+	if removed > 0 {
+		log.Info().Int("removed", removed).Msg("Pruned expired entries from cache store")
+	}
+}
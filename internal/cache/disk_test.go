@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskStore(t *testing.T) {
+	store := &DiskStore{dir: t.TempDir()}
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected a missing key to be ErrNotStored, got %v", err)
+	}
+	if err := store.Set(ctx, "key", []byte("value"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := store.Get(ctx, "key"); err != nil || string(value) != "value" {
+		t.Errorf("expected value, got %q (%v)", value, err)
+	}
+	if err := store.Delete(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "key"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected a deleted key to be ErrNotStored, got %v", err)
+	}
+	if err := store.Delete(ctx, "key"); err != nil {
+		t.Errorf("expected deleting a missing key to succeed, got %v", err)
+	}
+}
+
+func TestDiskStoreExpiry(t *testing.T) {
+	store := &DiskStore{dir: t.TempDir()}
+	ctx := context.Background()
+
+	if err := store.Set(ctx, "expired", []byte("value"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(store.path("expired")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "expired"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected an expired key to be ErrNotStored, got %v", err)
+	}
+	if _, err := os.Stat(store.path("expired")); !os.IsNotExist(err) {
+		t.Errorf("expected reading an expired key to remove it, got %v", err)
+	}
+
+	// files too short to hold an expiry are treated as expired
+	if err := os.WriteFile(store.path("expired"), []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "expired"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected a truncated entry to be ErrNotStored, got %v", err)
+	}
+}
+
+func TestDiskStorePrune(t *testing.T) {
+	store := &DiskStore{dir: t.TempDir()}
+	ctx := context.Background()
+
+	for key, ttl := range map[string]time.Duration{
+		"fresh":   time.Hour,
+		"expired": -time.Second,
+	} {
+		if err := store.Set(ctx, key, []byte(key), ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	truncated := store.path("truncated")
+	if err := os.MkdirAll(filepath.Dir(truncated), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(truncated, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// temporary files from writes that didn't finish, and one still being written
+	abandoned := filepath.Join(store.dir, ".abandoned.tmp")
+	writing := filepath.Join(store.dir, ".writing.tmp")
+	for _, filename := range []string{abandoned, writing} {
+		if err := os.WriteFile(filename, []byte("partial"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(abandoned, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	store.prune()
+
+	tests := []struct {
+		name     string
+		filename string
+		kept     bool
+	}{
+		{name: "fresh", filename: store.path("fresh"), kept: true},
+		{name: "expired", filename: store.path("expired")},
+		{name: "truncated", filename: truncated},
+		{name: "abandoned", filename: abandoned},
+		{name: "writing", filename: writing, kept: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := os.Stat(test.filename)
+			if test.kept && err != nil {
+				t.Errorf("expected the file to be kept, got %v", err)
+			}
+			if !test.kept && !os.IsNotExist(err) {
+				t.Errorf("expected the file to be removed, got %v", err)
+			}
+		})
+	}
+	if value, err := store.Get(ctx, "fresh"); err != nil || string(value) != "fresh" {
+		t.Errorf("expected fresh, got %q (%v)", value, err)
+	}
+}
+
+func TestDiskStorePrunesUntilClosed(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newDiskStore(dir, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// entries that expire while the store is open are removed without being read
+	if err := store.Set(ctx, "expired", []byte("value"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(store.path("expired")); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the expired entry to be pruned")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("expected closing again to succeed, got %v", err)
+	}
+	if err := store.Set(ctx, "closed", []byte("value"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := os.Stat(store.path("closed")); err != nil {
+		t.Errorf("expected pruning to stop once closed, got %v", err)
+	}
+}
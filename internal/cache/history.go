@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"slices"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/maypok86/otter/v2"
+)
+
+func newHistoryCache() *otter.Cache[string, model.History] {
+	return otter.Must(&otter.Options[string, model.History]{
+		MaximumSize: 10_000,
+		// forget feeds that nobody has requested for a while
+		ExpiryCalculator: otter.ExpiryAccessing[string, model.History](30 * 24 * time.Hour),
+	})
+}
+
+// RecordHistory merges entries into the history of a feed, recording when each
+// entry was first seen. It returns the combined entries, newest first, limited
+// to HistoryDepth - which is also how many entries are kept in the history
+func (c *Caches) RecordHistory(key string, entries []model.Entry, now time.Time) []model.Entry {
+	var result []model.Entry
+	depth := c.HistoryDepth
+	c.History.Compute(
+		key,
+		func(previous model.History, found bool) (model.History, otter.ComputeOp) {
+			merged := make(map[string]model.Entry, len(previous)+len(entries))
+			for id, entry := range previous {
+				merged[id] = entry
+			}
+			for _, entry := range entries {
+				entry.FirstSeen = now
+				if existing, ok := previous[entry.Id]; ok {
+					entry.FirstSeen = existing.FirstSeen
+				}
+				merged[entry.Id] = entry
+			}
+			for _, entry := range merged {
+				result = append(result, entry)
+			}
+			slices.SortFunc(result, func(a, b model.Entry) int {
+				return b.Date.Compare(a.Date)
+			})
+			if len(result) > depth {
+				result = result[:depth]
+			}
+			history := make(model.History, len(result))
+			for _, entry := range result {
+				history[entry.Id] = entry
+			}
+			return history, otter.WriteOp
+		},
+	)
+	return result
+}
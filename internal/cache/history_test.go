@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+)
+
+func TestRecordHistory(t *testing.T) {
+	caches := NewCaches(nil)
+	caches.HistoryDepth = 2
+	day := func(d int) time.Time { return time.Date(2025, 11, d, 0, 0, 0, 0, time.UTC) }
+	entry := func(id string, d int) model.Entry { return model.Entry{Id: id, Date: day(d)} }
+	ids := func(entries []model.Entry) []string {
+		var ids []string
+		for _, entry := range entries {
+			ids = append(ids, entry.Id)
+		}
+		return ids
+	}
+
+	first := caches.RecordHistory("feed", []model.Entry{entry("a", 1)}, day(1))
+	if !slices.Equal(ids(first), []string{"a"}) {
+		t.Errorf("expected [a], got %v", ids(first))
+	}
+	// a drops out of the feed, but is kept from the history
+	second := caches.RecordHistory("feed", []model.Entry{entry("b", 2)}, day(2))
+	if !slices.Equal(ids(second), []string{"b", "a"}) {
+		t.Errorf("expected [b a], got %v", ids(second))
+	}
+	// only HistoryDepth entries are kept, newest first
+	third := caches.RecordHistory("feed", []model.Entry{entry("c", 3), entry("b", 2)}, day(3))
+	if !slices.Equal(ids(third), []string{"c", "b"}) {
+		t.Errorf("expected [c b], got %v", ids(third))
+	}
+	if !third[1].FirstSeen.Equal(day(2)) {
+		t.Errorf("expected b to be first seen %s, got %s", day(2), third[1].FirstSeen)
+	}
+	if history, _ := caches.History.GetIfPresent("feed"); len(history) != 2 {
+		t.Errorf("expected 2 entries in the history, got %d", len(history))
+	}
+
+	// each set of caches has its own history
+	other := NewCaches(nil)
+	if _, ok := other.History.GetIfPresent("feed"); ok {
+		t.Error("expected new caches to start without history")
+	}
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often expired entries are removed from a
+// MemoryStore, as they're otherwise only removed when they're read
+const memorySweepInterval = time.Minute
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStore is a Store that only lives as long as the process, for running
+// without any other services, and for tests
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	swept   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), swept: time.Now()}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, ErrNotStored
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(s.entries, key)
+		return nil, ErrNotStored
+	}
+	return entry.value, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.swept) > memorySweepInterval {
+		for key, entry := range s.entries {
+			if !now.Before(entry.expires) {
+				delete(s.entries, key)
+			}
+		}
+		s.swept = now
+	}
+	s.entries[key] = memoryEntry{value: append([]byte(nil), value...), expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
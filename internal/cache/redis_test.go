@@ -0,0 +1,463 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type respEntry struct {
+	value   string
+	expires time.Time
+}
+
+// respServer is a stand-in for a Redis server, supporting the commands the
+// store uses: AUTH, SELECT, GET, SET with PX and DEL
+type respServer struct {
+	listener net.Listener
+	username string
+	password string
+	// drop closes the connection instead of replying to the command
+	drop string
+
+	mu       sync.Mutex
+	data     map[int]map[string]respEntry
+	commands [][]string
+	accepted int
+	closed   int
+}
+
+func newRespServer(t *testing.T, username, password string) *respServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &respServer{
+		listener: listener,
+		username: username,
+		password: password,
+		data:     make(map[int]map[string]respEntry),
+	}
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.accepted++
+			s.mu.Unlock()
+			wg.Go(func() {
+				defer conn.Close()
+				s.serve(conn)
+				s.mu.Lock()
+				s.closed++
+				s.mu.Unlock()
+			})
+		}
+	})
+	t.Cleanup(func() {
+		listener.Close()
+		wg.Wait()
+	})
+	return s
+}
+
+func (s *respServer) url(userinfo, db string) string {
+	if userinfo != "" {
+		userinfo += "@"
+	}
+	return fmt.Sprintf("redis://%s%s/%s", userinfo, s.listener.Addr(), db)
+}
+
+// readCommand reads an array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	var count int
+	if _, err := fmt.Fscanf(reader, "*%d\r\n", &count); err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func (s *respServer) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	authenticated := s.password == ""
+	db := 0
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(args[0])
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		if s.data[db] == nil {
+			s.data[db] = make(map[string]respEntry)
+		}
+		data := s.data[db]
+		var reply string
+		switch {
+		case command == s.drop:
+			s.mu.Unlock()
+			return
+		case command == "AUTH":
+			username, password := "default", args[len(args)-1]
+			if len(args) == 3 {
+				username = args[1]
+			}
+			if password != s.password || (s.username != "" && username != s.username) {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			} else {
+				authenticated = true
+				reply = "+OK\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case command == "SELECT":
+			db, _ = strconv.Atoi(args[1])
+			reply = "+OK\r\n"
+		case command == "GET":
+			entry, ok := data[args[1]]
+			switch {
+			case ok && entry.value == "wrong type":
+				reply = "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+			case ok && time.Now().Before(entry.expires):
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(entry.value), entry.value)
+			default:
+				reply = "$-1\r\n"
+			}
+		case command == "SET":
+			ms, _ := strconv.Atoi(args[4])
+			data[args[1]] = respEntry{
+				value:   args[2],
+				expires: time.Now().Add(time.Duration(ms) * time.Millisecond),
+			}
+			reply = "+OK\r\n"
+		case command == "DEL":
+			_, ok := data[args[1]]
+			delete(data, args[1])
+			reply = fmt.Sprintf(":%d\r\n", map[bool]int{false: 0, true: 1}[ok])
+		default:
+			reply = fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+		}
+		s.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// received returns the commands received, by name
+func (s *respServer) received(command string) [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var received [][]string
+	for _, args := range s.commands {
+		if strings.EqualFold(args[0], command) {
+			received = append(received, args)
+		}
+	}
+	return received
+}
+
+func (s *respServer) connections() (accepted, closed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted, s.closed
+}
+
+func TestRedisRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  any
+		err   string
+	}{
+		{name: "simple string", reply: "+OK\r\n", want: "OK"},
+		{name: "error", reply: "-ERR wrong\r\n", err: "redis: ERR wrong"},
+		{name: "integer", reply: ":42\r\n", want: int64(42)},
+		{name: "bulk string", reply: "$5\r\nhe\r\no\r\n", want: []byte("he\r\no")},
+		{name: "empty bulk string", reply: "$0\r\n\r\n", want: []byte{}},
+		{name: "nil bulk string", reply: "$-1\r\n", want: nil},
+		{
+			name:  "array",
+			reply: "*3\r\n$1\r\na\r\n:1\r\n*1\r\n+b\r\n",
+			want:  []any{[]byte("a"), int64(1), []any{"b"}},
+		},
+		{name: "nil array", reply: "*-1\r\n", want: nil},
+		{name: "unknown type", reply: "?what\r\n", err: `redis: unexpected reply "?what"`},
+		{name: "empty", reply: "\r\n", err: "redis: empty reply"},
+		{name: "truncated bulk string", reply: "$5\r\nhe", err: "unexpected EOF"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &redisConn{reader: bufio.NewReader(strings.NewReader(test.reply))}
+			reply, err := conn.read()
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reply, test.want) {
+				t.Errorf("expected %#v, got %#v", test.want, reply)
+			}
+		})
+	}
+}
+
+func TestRedisConnect(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		userinfo string
+		db       string
+		auth     []string
+		selected []string
+		err      bool
+	}{
+		{name: "no auth"},
+		{
+			name:     "password",
+			password: "secret",
+			userinfo: "secret",
+			auth:     []string{"AUTH", "secret"},
+		},
+		{
+			name:     "username and password",
+			username: "bookfeed",
+			password: "secret",
+			userinfo: "bookfeed:secret",
+			db:       "3",
+			auth:     []string{"AUTH", "bookfeed", "secret"},
+			selected: []string{"SELECT", "3"},
+		},
+		{name: "database", db: "2", selected: []string{"SELECT", "2"}},
+		{name: "default database", db: "0"},
+		{name: "wrong password", password: "secret", userinfo: "guess", err: true},
+		{name: "missing password", password: "secret", db: "1", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newRespServer(t, test.username, test.password)
+			store, err := NewRedisStore(server.url(test.userinfo, test.db))
+			if test.err {
+				if err == nil {
+					store.Close()
+					t.Fatal("expected connecting to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			auth := server.received("AUTH")
+			if (test.auth == nil) != (len(auth) == 0) ||
+				(test.auth != nil && !slices.Equal(auth[0], test.auth)) {
+				t.Errorf("expected %q, got %q", test.auth, auth)
+			}
+			selected := server.received("SELECT")
+			if (test.selected == nil) != (len(selected) == 0) ||
+				(test.selected != nil && !slices.Equal(selected[0], test.selected)) {
+				t.Errorf("expected %q, got %q", test.selected, selected)
+			}
+
+			// commands work once connected, in the selected database
+			ctx := context.Background()
+			if err := store.Set(ctx, "key", []byte("value"), time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			value, err := store.Get(ctx, "key")
+			if err != nil || string(value) != "value" {
+				t.Errorf("expected value, got %q (%v)", value, err)
+			}
+			db, _ := strconv.Atoi(test.db)
+			server.mu.Lock()
+			_, ok := server.data[db][redisKeyPrefix+"key"]
+			server.mu.Unlock()
+			if !ok {
+				t.Errorf("expected the key to be set in database %d", db)
+			}
+		})
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	server := newRespServer(t, "", "")
+	store, err := NewRedisStore(server.url("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected a missing key to be ErrNotStored, got %v", err)
+	}
+	// values are binary, e.g. gob encoded
+	value := []byte("\x00\x01\r\n\xff")
+	if err := store.Set(ctx, "collection/abc/key", value, 90*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(ctx, "collection/abc/key")
+	if err != nil || string(got) != string(value) {
+		t.Errorf("expected %q, got %q (%v)", value, got, err)
+	}
+	if err := store.Delete(ctx, "collection/abc/key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "collection/abc/key"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected a deleted key to be ErrNotStored, got %v", err)
+	}
+
+	want := [][]string{
+		{"SET", "bookfeed:collection/abc/key", string(value), "PX", "90000"},
+	}
+	if set := server.received("SET"); !reflect.DeepEqual(set, want) {
+		t.Errorf("expected %q, got %q", want, set)
+	}
+}
+
+func TestRedisStoreTTL(t *testing.T) {
+	server := newRespServer(t, "", "")
+	store, err := NewRedisStore(server.url("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		ttl  time.Duration
+		want string
+	}{
+		{ttl: 12 * time.Hour, want: "43200000"},
+		{ttl: 1500 * time.Microsecond, want: "1"},
+		// a TTL of 0 would be rejected by the server
+		{ttl: 0, want: "1"},
+	}
+	for _, test := range tests {
+		t.Run(test.ttl.String(), func(t *testing.T) {
+			if err := store.Set(ctx, "key", []byte("value"), test.ttl); err != nil {
+				t.Fatal(err)
+			}
+			set := server.received("SET")
+			if px := set[len(set)-1][4]; px != test.want {
+				t.Errorf("expected PX %s, got %s", test.want, px)
+			}
+		})
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := store.Get(ctx, "key"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected the expired key to be ErrNotStored, got %v", err)
+	}
+}
+
+func TestRedisStorePool(t *testing.T) {
+	server := newRespServer(t, "", "")
+	store, err := NewRedisStore(server.url("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	for range 5 {
+		if _, err := store.Get(ctx, "key"); !errors.Is(err, ErrNotStored) {
+			t.Fatal(err)
+		}
+	}
+	if accepted, _ := server.connections(); accepted != 1 {
+		t.Errorf("expected the connection to be reused, got %d connections", accepted)
+	}
+
+	// error replies leave the connection usable
+	server.mu.Lock()
+	server.data[0] = map[string]respEntry{redisKeyPrefix + "list": {value: "wrong type"}}
+	server.mu.Unlock()
+	var replyErr redisError
+	if _, err := store.Get(ctx, "list"); !errors.As(err, &replyErr) {
+		t.Errorf("expected an error reply, got %v", err)
+	}
+	if accepted, _ := server.connections(); accepted != 1 {
+		t.Errorf("expected the connection to be reused after an error reply, got %d", accepted)
+	}
+
+	// connections that fail aren't reused
+	server.mu.Lock()
+	server.drop = "DEL"
+	server.mu.Unlock()
+	if err := store.Delete(ctx, "key"); err == nil {
+		t.Error("expected the dropped connection to return an error")
+	}
+	if _, err := store.Get(ctx, "key"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("expected a new connection to be used, got %v", err)
+	}
+	if accepted, _ := server.connections(); accepted != 2 {
+		t.Errorf("expected a new connection after the failure, got %d connections", accepted)
+	}
+
+	// only some connections are kept idle
+	var conns []*redisConn
+	for range redisMaxIdle + 3 {
+		conn, err := store.conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		store.release(conn)
+	}
+	store.mu.Lock()
+	idle := len(store.idle)
+	store.mu.Unlock()
+	if idle != redisMaxIdle {
+		t.Errorf("expected %d idle connections, got %d", redisMaxIdle, idle)
+	}
+
+	store.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		accepted, closed := server.connections()
+		if accepted == closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected every connection to be closed, %d of %d are open",
+				accepted-closed, accepted)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/maypok86/otter/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// hotWindow is how recently a key must have been requested to be
+	// refreshed in the background
+	hotWindow = 24 * time.Hour
+	// refreshBatchSize limits how many keys are reloaded by a single query
+	refreshBatchSize = 50
+)
+
+type trackedKey struct {
+	group    string
+	accessed time.Time
+}
+
+// refresher tracks which keys of a cache are being requested, so they can be
+// reloaded in the background before they expire. Keys in the same group can
+// be reloaded together by the group's bulk loader
+type refresher[V any] struct {
+	cache *otter.Cache[string, V]
+	// grew reports whether a reloaded value has more in it than before, and
+	// is nil when that isn't tracked
+	grew    func(before, after V) bool
+	mu      sync.Mutex
+	loaders map[string]otter.BulkLoader[string, V]
+	keys    map[string]trackedKey
+}
+
+func newRefresher[V any](cache *otter.Cache[string, V]) *refresher[V] {
+	return &refresher[V]{
+		cache:   cache,
+		loaders: make(map[string]otter.BulkLoader[string, V]),
+		keys:    make(map[string]trackedKey),
+	}
+}
+
+func (r *refresher[V]) track(
+	group string,
+	keys []string,
+	loader otter.BulkLoader[string, V],
+	now time.Time,
+) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loaders[group] = loader
+	for _, key := range keys {
+		r.keys[key] = trackedKey{group: group, accessed: now}
+	}
+}
+
+// due returns the keys that are still being requested, but will expire before
+// the deadline, by group. Keys that are no longer requested or cached are
+// forgotten
+func (r *refresher[V]) due(now, deadline time.Time) map[string][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make(map[string][]string)
+	groups := make(map[string]bool)
+	for key, tracked := range r.keys {
+		entry, ok := r.cache.GetEntryQuietly(key)
+		if !ok || now.Sub(tracked.accessed) > hotWindow {
+			delete(r.keys, key)
+			continue
+		}
+		groups[tracked.group] = true
+		if entry.ExpiresAt().Before(deadline) {
+			result[tracked.group] = append(result[tracked.group], key)
+		}
+	}
+	for group := range r.loaders {
+		if !groups[group] {
+			delete(r.loaders, group)
+		}
+	}
+	return result
+}
+
+// refresh reloads the keys that are due, a batch at a time. The previous
+// values are served until their replacements are loaded, and are kept if
+// reloading fails. It returns the keys whose values grew
+func (r *refresher[V]) refresh(
+	ctx context.Context,
+	now, deadline time.Time,
+) (refreshed, failed int, grown []string) {
+	for group, keys := range r.due(now, deadline) {
+		r.mu.Lock()
+		loader := r.loaders[group]
+		r.mu.Unlock()
+		for start := 0; start < len(keys); start += refreshBatchSize {
+			batch := keys[start:min(start+refreshBatchSize, len(keys))]
+			before := make(map[string]V, len(batch))
+			for _, key := range batch {
+				if entry, ok := r.cache.GetEntryQuietly(key); ok {
+					before[key] = entry.Value
+				}
+			}
+			var results []otter.RefreshResult[string, V]
+			select {
+			case results = <-r.cache.BulkRefresh(ctx, batch, loader):
+			case <-ctx.Done():
+				return refreshed, failed, grown
+			}
+			for _, result := range results {
+				if result.Err != nil {
+					failed++
+					continue
+				}
+				refreshed++
+				previous, ok := before[result.Key]
+				if ok && r.grew != nil && r.grew(previous, result.Value) {
+					grown = append(grown, result.Key)
+				}
+			}
+		}
+	}
+	return refreshed, failed, grown
+}
+
+// bulkLoader adapts a loader for a single key, for caches that don't have
+// bulk queries
+func bulkLoader[V any](loader otter.LoaderFunc[string, V]) otter.BulkLoaderFunc[string, V] {
+	return func(ctx context.Context, keys []string) (map[string]V, error) {
+		result := make(map[string]V)
+		var errs []error
+		for _, key := range keys {
+			value, err := loader(ctx, key)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			result[key] = value
+		}
+		return result, errors.Join(errs...)
+	}
+}
+
+// TrackCollections records that collections were requested, and how to reload
+// them. Loaders tracked with the same group must be able to load any key in
+// the group, so they're shared across requests
+func (c *Caches) TrackCollections(group string, keys []string, loader BulkCollectionLoaderFunc) {
+	c.collectionRefresher.track(group, keys, c.reloadCollections(loader), time.Now())
+}
+
+// TrackCollection records that a collection without a bulk loader was
+// requested
+func (c *Caches) TrackCollection(key string, loader CollectionLoaderFunc) {
+	reload := c.reloadCollections(bulkLoader(loader))
+	c.collectionRefresher.track(key, []string{key}, reload, time.Now())
+}
+
+// TrackUser records that a user's interests were requested
+func (c *Caches) TrackUser(key string, loader UserLoaderFunc) {
+	reload := throughStore(c.store, "user", userExpiry, nil, c.keepLastUsers(bulkLoader(loader)))
+	c.userRefresher.track(key, []string{key}, reload, time.Now())
+}
+
+// reloadCollections wraps a loader to replace the copies of what it loads in
+// the store
+func (c *Caches) reloadCollections(loader BulkCollectionLoaderFunc) BulkCollectionLoaderFunc {
+	return throughStore(c.store, "collection", collectionExpiry, nil, c.keepLastCollections(loader))
+}
+
+// RefreshAhead reloads collections and users that are still being requested,
+// before they expire at the deadline, so readers don't wait for them to load.
+// It returns the keys of the collections that gained books
+func (c *Caches) RefreshAhead(ctx context.Context, deadline time.Time) (grown []string) {
+	now := time.Now()
+	collections, collectionErrors, grown := c.collectionRefresher.refresh(ctx, now, deadline)
+	users, userErrors, _ := c.userRefresher.refresh(ctx, now, deadline)
+	if collections+collectionErrors+users+userErrors == 0 {
+		return nil
+	}
+	log.Info().
+		Int("collections", collections).
+		Int("grown", len(grown)).
+		Int("users", users).
+		Int("failed", collectionErrors+userErrors).
+		Dur("elapsed", time.Since(now)).
+		Msg("Refreshed cache ahead of expiry")
+	return grown
+}
+
+// gainedBooks reports whether a collection has books it didn't have before
+func gainedBooks(before, after model.Collection) bool {
+	known := make(map[int]bool, len(before.Books))
+	for _, book := range before.Books {
+		known[book.Id] = true
+	}
+	for _, book := range after.Books {
+		if !known[book.Id] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+)
+
+func TestRefreshAheadReportsGrownCollections(t *testing.T) {
+	caches := NewCaches(nil)
+	// each load returns the next list of books, repeating the last
+	loads := [][]int{{1}, {1, 2}, {2, 1}, {2}}
+	var calls atomic.Int32
+	loader := CollectionLoaderFunc(
+		func(ctx context.Context, key string) (model.Collection, error) {
+			ids := loads[min(int(calls.Add(1))-1, len(loads)-1)]
+			var books []model.Book
+			for _, id := range ids {
+				books = append(books, model.Book{Id: id})
+			}
+			return model.NewCollection("Brandon Sanderson", "brandon-sanderson", books), nil
+		},
+	)
+	ctx := context.Background()
+	key := "hardcover/author/brandon-sanderson"
+	caches.TrackCollection(key, loader)
+	if _, _, err := caches.GetCollection(ctx, key, loader); err != nil {
+		t.Fatal(err)
+	}
+
+	// collections expire within a day, so are always due
+	deadline := time.Now().Add(24 * time.Hour)
+	want := [][]string{
+		{key}, // gained book 2
+		nil,   // same books in another order
+		nil,   // lost book 1
+	}
+	for i, want := range want {
+		if grown := caches.RefreshAhead(ctx, deadline); !slices.Equal(grown, want) {
+			t.Errorf("refresh %d: expected %q to have grown, got %q", i+1, want, grown)
+		}
+	}
+}
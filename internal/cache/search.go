@@ -0,0 +1,17 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/maypok86/otter/v2"
+)
+
+// newSearchCache keeps search results for autocomplete, which repeats the
+// same few queries as people type. It isn't saved, as results go stale
+func newSearchCache() *otter.Cache[string, []model.SearchResult] {
+	return otter.Must(&otter.Options[string, []model.SearchResult]{
+		MaximumSize:      10_000,
+		ExpiryCalculator: otter.ExpiryCreating[string, []model.SearchResult](time.Hour),
+	})
+}
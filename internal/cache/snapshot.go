@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/maypok86/otter/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	snapshotMagic = "bookfeed-snapshot"
+	// snapshotVersion is the layout of snapshot files: a header line, then
+	// the entries as otter saves them. Version 0 is the entries on their own,
+	// from before snapshots had a header
+	snapshotVersion = 1
+)
+
+// snapshotHeader is the first line of a snapshot, e.g.
+// "bookfeed-snapshot 1 collection 9f86d081884c7d65"
+type snapshotHeader struct {
+	Version int
+	Name    string
+	// Schema is a hash of the shape of the cached values, see schemaOf
+	Schema string
+}
+
+func (h snapshotHeader) String() string {
+	return fmt.Sprintf("%s %d %s %s\n", snapshotMagic, h.Version, h.Name, h.Schema)
+}
+
+// readSnapshotHeader reads the header of a snapshot, leaving the reader at
+// the start of the entries. Snapshots without one are version 0
+func readSnapshotHeader(r *bufio.Reader) (snapshotHeader, error) {
+	var header snapshotHeader
+	start, _ := r.Peek(len(snapshotMagic))
+	if !bytes.Equal(start, []byte(snapshotMagic)) {
+		return header, nil
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return header, fmt.Errorf("read snapshot header: %w", err)
+	}
+	var magic string
+	_, err = fmt.Sscanf(
+		line,
+		"%s %d %s %s\n",
+		&magic,
+		&header.Version,
+		&header.Name,
+		&header.Schema,
+	)
+	if err != nil {
+		return header, fmt.Errorf("parse snapshot header %q: %w", strings.TrimSpace(line), err)
+	}
+	return header, nil
+}
+
+var schemas sync.Map
+
+// schemaOf hashes the shape of a type as gob sees it - the names and types of
+// exported struct fields, all the way down - so any change that could stop a
+// snapshot decoding cleanly, or silently drop fields, changes the hash
+func schemaOf[V any]() string {
+	t := reflect.TypeFor[V]()
+	if schema, ok := schemas.Load(t); ok {
+		return schema.(string)
+	}
+	var b strings.Builder
+	describeType(&b, t, make(map[reflect.Type]bool))
+	sum := sha256.Sum256([]byte(b.String()))
+	schema := hex.EncodeToString(sum[:8])
+	schemas.Store(t, schema)
+	return schema
+}
+
+var (
+	gobEncoderType    = reflect.TypeFor[gob.GobEncoder]()
+	binaryMarshalType = reflect.TypeFor[encoding.BinaryMarshaler]()
+)
+
+func describeType(b *strings.Builder, t reflect.Type, seen map[reflect.Type]bool) {
+	// types that encode themselves, like time.Time, are opaque to gob
+	if t.Implements(gobEncoderType) || t.Implements(binaryMarshalType) {
+		b.WriteString(t.String())
+		return
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		describeType(b, t.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		b.WriteString("[]")
+		describeType(b, t.Elem(), seen)
+	case reflect.Map:
+		b.WriteString("map[")
+		describeType(b, t.Key(), seen)
+		b.WriteString("]")
+		describeType(b, t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			b.WriteString(t.String())
+			return
+		}
+		seen[t] = true
+		b.WriteString("{")
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			b.WriteString(field.Name + " ")
+			describeType(b, field.Type, seen)
+			b.WriteString(";")
+		}
+		b.WriteString("}")
+	default:
+		b.WriteString(t.Kind().String())
+	}
+}
+
+// writeAtomic writes to a temporary file next to filename, then renames it
+// over filename, so readers and crashes never see a partial write
+func writeAtomic(filename string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	buffered := bufio.NewWriter(file)
+	err = write(buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
+
+// setAside renames a snapshot that can't be loaded as it is, so it's kept
+// for inspection or recovery rather than overwritten by the next save
+func setAside(cachePath, reason string) string {
+	suffix := time.Now().UTC().Format("20060102T150405Z")
+	target := fmt.Sprintf("%s.%s-%s", cachePath, reason, suffix)
+	if err := os.Rename(cachePath, target); err != nil {
+		log.Error().Err(err).Str("path", cachePath).Msg("Unable to move snapshot aside")
+		return cachePath
+	}
+	return target
+}
+
+func snapshotPath(name string) string {
+	return path.Join(config.CacheStorage(), fmt.Sprintf("%s.gob", name))
+}
+
+// loadCache loads a snapshot into the cache. Snapshots from another version
+// or with a different schema are discarded if the cache can be rebuilt from
+// the providers. Durable caches, whose data can't be rebuilt, are migrated
+// instead, by decoding fields with matching names, and the original is kept.
+// Snapshots that can't be decoded are quarantined, and nothing is loaded from
+// them
+func loadCache[V any](c *otter.Cache[string, V], name string, durable bool) {
+	cachePath := snapshotPath(name)
+	log := log.With().Str("path", cachePath).Logger()
+	log.Info().Msgf("Loading %s cache", name)
+	file, err := os.Open(cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Load cache failed")
+		return
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header, err := readSnapshotHeader(reader)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("moved", setAside(cachePath, "corrupt")).
+			Msg("Quarantined snapshot")
+		return
+	}
+	schema := schemaOf[V]()
+	current := header.Version == snapshotVersion && header.Schema == schema
+	log = log.With().Int("version", header.Version).Str("schema", header.Schema).Logger()
+	if !current && !durable {
+		log.Warn().Msg("Discarding snapshot from another version")
+		if err := os.Remove(cachePath); err != nil {
+			log.Error().Err(err).Msg("Unable to remove snapshot")
+		}
+		return
+	}
+	if header.Version > snapshotVersion {
+		// the layout is unknown, so keep it for the release that wrote it
+		log.Error().
+			Str("moved", setAside(cachePath, "unknown")).
+			Msg("Snapshot is from a newer release")
+		return
+	}
+
+	if err := otter.LoadCacheFrom(c, reader); err != nil {
+		// caches are loaded when they're created, so this only drops the
+		// entries read before the error, rather than serving part of the file
+		c.InvalidateAll()
+		log.Error().
+			Err(err).
+			Str("moved", setAside(cachePath, "corrupt")).
+			Msg("Quarantined snapshot")
+		return
+	}
+	if !current {
+		log.Info().
+			Str("moved", setAside(cachePath, "premigration")).
+			Int("entries", c.EstimatedSize()).
+			Msgf("Migrated %s cache to schema %s", name, schema)
+		saveCache(c, name)
+	}
+}
+
+func saveCache[V any](c *otter.Cache[string, V], name string) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	cachePath := snapshotPath(name)
+	log.Info().Str("path", cachePath).Msgf("Saving %s cache", name)
+	header := snapshotHeader{Version: snapshotVersion, Name: name, Schema: schemaOf[V]()}
+	err := writeAtomic(cachePath, func(w io.Writer) error {
+		if _, err := io.WriteString(w, header.String()); err != nil {
+			return err
+		}
+		return otter.SaveCacheTo(c, w)
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Save cache failed")
+	}
+	return err
+}
@@ -0,0 +1,326 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/maypok86/otter/v2"
+)
+
+type snapshotValue struct {
+	Name    string
+	Count   int
+	Updated time.Time
+}
+
+// snapshotValueV2 is snapshotValue after a field was renamed and one added
+type snapshotValueV2 struct {
+	Name   string
+	Total  int
+	Labels []string
+}
+
+// useSnapshotStorage stores snapshots in a temporary directory, returned
+func useSnapshotStorage(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("CACHE_STORAGE_PATH", dir)
+	if err := config.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func newSnapshotCache[V any](entries map[string]V) *otter.Cache[string, V] {
+	c := otter.Must(&otter.Options[string, V]{})
+	for key, value := range entries {
+		c.Set(key, value)
+	}
+	return c
+}
+
+func cacheEntries[V any](c *otter.Cache[string, V]) map[string]V {
+	return maps.Collect(c.All())
+}
+
+// snapshotFiles returns the files in dir, besides the snapshot itself
+func snapshotFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+var savedValues = map[string]snapshotValue{
+	"a": {Name: "first", Count: 1, Updated: time.Date(2025, 11, 1, 12, 0, 0, 0, time.UTC)},
+	"b": {Name: "second", Count: 2},
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	for _, durable := range []bool{false, true} {
+		name := "rebuildable"
+		if durable {
+			name = "durable"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := useSnapshotStorage(t)
+			if err := saveCache(newSnapshotCache(savedValues), "test"); err != nil {
+				t.Fatal(err)
+			}
+			loaded := newSnapshotCache[snapshotValue](nil)
+			loadCache(loaded, "test", durable)
+
+			got := cacheEntries(loaded)
+			if len(got) != len(savedValues) {
+				t.Fatalf("expected %d entries, got %v", len(savedValues), got)
+			}
+			for key, want := range savedValues {
+				value := got[key]
+				if value.Name != want.Name || value.Count != want.Count ||
+					!value.Updated.Equal(want.Updated) {
+					t.Errorf("expected %s to be %+v, got %+v", key, want, value)
+				}
+			}
+			if files := snapshotFiles(t, dir); len(files) != 1 || files[0] != "test.gob" {
+				t.Errorf("expected only the snapshot to be left, got %v", files)
+			}
+		})
+	}
+}
+
+func TestSnapshotSchemaMismatch(t *testing.T) {
+	t.Run("rebuildable snapshots are discarded", func(t *testing.T) {
+		dir := useSnapshotStorage(t)
+		if err := saveCache(newSnapshotCache(savedValues), "test"); err != nil {
+			t.Fatal(err)
+		}
+		loaded := newSnapshotCache[snapshotValueV2](nil)
+		loadCache(loaded, "test", false)
+
+		if got := cacheEntries(loaded); len(got) != 0 {
+			t.Errorf("expected nothing to be loaded, got %v", got)
+		}
+		if files := snapshotFiles(t, dir); len(files) != 0 {
+			t.Errorf("expected the snapshot to be removed, got %v", files)
+		}
+	})
+
+	t.Run("durable snapshots are migrated and set aside", func(t *testing.T) {
+		dir := useSnapshotStorage(t)
+		if err := saveCache(newSnapshotCache(savedValues), "test"); err != nil {
+			t.Fatal(err)
+		}
+		loaded := newSnapshotCache[snapshotValueV2](nil)
+		loadCache(loaded, "test", true)
+
+		// only fields with matching names are kept
+		got := cacheEntries(loaded)
+		if value := got["a"]; value.Name != "first" || value.Total != 0 {
+			t.Errorf("expected a to be migrated by name, got %+v", value)
+		}
+		var kept []string
+		for _, name := range snapshotFiles(t, dir) {
+			if name != "test.gob" {
+				kept = append(kept, name)
+			}
+		}
+		if len(kept) != 1 || !strings.HasPrefix(kept[0], "test.gob.premigration-") {
+			t.Fatalf("expected the original snapshot to be set aside, got %v", kept)
+		}
+
+		// the migrated snapshot has the new schema, so isn't migrated again
+		file, err := os.Open(filepath.Join(dir, "test.gob"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		header, err := io.ReadAll(io.LimitReader(file, 128))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(header), schemaOf[snapshotValueV2]()) {
+			t.Errorf("expected the snapshot to be saved with the new schema, got %q", header)
+		}
+	})
+
+	t.Run("snapshots from newer releases are set aside", func(t *testing.T) {
+		dir := useSnapshotStorage(t)
+		header := snapshotHeader{
+			Version: snapshotVersion + 1,
+			Name:    "test",
+			Schema:  "0123456789abcdef",
+		}
+		err := os.WriteFile(snapshotPath("test"), []byte(header.String()+"future"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded := newSnapshotCache[snapshotValue](nil)
+		loadCache(loaded, "test", true)
+
+		if got := cacheEntries(loaded); len(got) != 0 {
+			t.Errorf("expected nothing to be loaded, got %v", got)
+		}
+		files := snapshotFiles(t, dir)
+		if len(files) != 1 || !strings.HasPrefix(files[0], "test.gob.unknown-") {
+			t.Errorf("expected the snapshot to be set aside, got %v", files)
+		}
+	})
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{
+			name:    "truncated",
+			corrupt: func(data []byte) []byte { return data[:len(data)-10] },
+		},
+		{
+			name: "garbled entries",
+			corrupt: func(data []byte) []byte {
+				header, _, _ := strings.Cut(string(data), "\n")
+				return []byte(header + "\nnot a gob stream")
+			},
+		},
+		{
+			name:    "garbled header",
+			corrupt: func(data []byte) []byte { return []byte(snapshotMagic + " one test\n") },
+		},
+		{
+			name:    "header without entries",
+			corrupt: func(data []byte) []byte { return []byte(snapshotMagic + " 1 test") },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := useSnapshotStorage(t)
+			if err := saveCache(newSnapshotCache(savedValues), "test"); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(snapshotPath("test"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(snapshotPath("test"), test.corrupt(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := newSnapshotCache[snapshotValue](nil)
+			loadCache(loaded, "test", true)
+			if got := cacheEntries(loaded); len(got) != 0 {
+				t.Errorf("expected nothing to be loaded, got %v", got)
+			}
+			files := snapshotFiles(t, dir)
+			if len(files) != 1 || !strings.HasPrefix(files[0], "test.gob.corrupt-") {
+				t.Errorf("expected the snapshot to be quarantined, got %v", files)
+			}
+		})
+	}
+}
+
+func TestWriteAtomicFailure(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.gob")
+	if err := os.WriteFile(filename, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("encoding failed")
+	err := writeAtomic(filename, func(w io.Writer) error {
+		if _, err := io.WriteString(w, "partial"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("expected the write error, got %v", err)
+	}
+	if data, err := os.ReadFile(filename); err != nil || string(data) != "previous" {
+		t.Errorf("expected the previous contents to be kept, got %q (%v)", data, err)
+	}
+	if files := snapshotFiles(t, dir); len(files) != 1 {
+		t.Errorf("expected no temporary files to be left, got %v", files)
+	}
+
+	// a new file isn't created by a failed write either
+	missing := filepath.Join(dir, "missing", "test.gob")
+	if err := writeAtomic(missing, func(w io.Writer) error { return failure }); err == nil {
+		t.Error("expected the write to fail")
+	}
+	if files := snapshotFiles(t, filepath.Dir(missing)); len(files) != 0 {
+		t.Errorf("expected nothing to be written, got %v", files)
+	}
+}
+
+func TestSchemaOf(t *testing.T) {
+	type unexported struct {
+		Name  string
+		count int
+	}
+	type nested struct {
+		Value snapshotValue
+	}
+	type nestedV2 struct {
+		Value snapshotValueV2
+	}
+	type recursive struct {
+		Name     string
+		Children []recursive
+	}
+
+	if schemaOf[snapshotValue]() != schemaOf[snapshotValue]() {
+		t.Error("expected the same type to have the same schema")
+	}
+	if schemaOf[snapshotValue]() == schemaOf[snapshotValueV2]() {
+		t.Error("expected renamed and added fields to change the schema")
+	}
+	if schemaOf[nested]() == schemaOf[nestedV2]() {
+		t.Error("expected a change to a nested type to change the schema")
+	}
+	if schemaOf[unexported]() != schemaOf[struct{ Name string }]() {
+		t.Error("expected unexported fields not to change the schema")
+	}
+	if schemaOf[[]snapshotValue]() == schemaOf[map[string]snapshotValue]() {
+		t.Error("expected slices and maps to have different schemas")
+	}
+	if schema := schemaOf[recursive](); len(schema) != 16 {
+		t.Errorf("expected a 16 character schema for a recursive type, got %q", schema)
+	}
+}
+
+func TestSetAside(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.gob")
+	if err := os.WriteFile(filename, []byte("snapshot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	target := setAside(filename, "corrupt")
+	if !strings.HasPrefix(target, filename+".corrupt-") {
+		t.Errorf("expected the snapshot to be moved next to itself, got %q", target)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "snapshot" {
+		t.Errorf("expected the snapshot to be kept, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("expected the snapshot to be moved, got %v", err)
+	}
+
+	if got := setAside(filename, "corrupt"); got != filename {
+		t.Errorf("expected a snapshot that can't be moved to stay at %q, got %q", filename, got)
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/maypok86/otter/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const staleExpiry = 14 * 24 * time.Hour
+
+func newStaleCache[V any]() *otter.Cache[string, V] {
+	return otter.Must(&otter.Options[string, V]{
+		MaximumSize:      10_000,
+		ExpiryCalculator: otter.ExpiryWriting[string, V](staleExpiry),
+	})
+}
+
+// keepLastGood copies every value the loader finds into stale, and into the
+// store under name
+func keepLastGood[V any](
+	stale *otter.Cache[string, V],
+	store Store,
+	name string,
+	found func(V) bool,
+	loader otter.BulkLoaderFunc[string, V],
+) otter.BulkLoaderFunc[string, V] {
+	return func(ctx context.Context, keys []string) (map[string]V, error) {
+		result, err := loader(ctx, keys)
+		if err != nil {
+			return result, err
+		}
+		for key, value := range result {
+			if found(value) {
+				stale.Set(key, value)
+				storeSet(ctx, store, name, key, value, staleExpiry)
+			}
+		}
+		return result, nil
+	}
+}
+
+// lastGood returns the last value found for a key, which may have been
+// loaded by another replica
+func lastGood[V any](
+	ctx context.Context,
+	stale *otter.Cache[string, V],
+	store Store,
+	name, key string,
+) (V, bool) {
+	if value, ok := stale.GetIfPresent(key); ok {
+		return value, true
+	}
+	entry, ok := storeGet[V](ctx, store, name, key)
+	return entry.Value, ok
+}
+
+func (c *Caches) keepLastCollections(loader BulkCollectionLoaderFunc) BulkCollectionLoaderFunc {
+	found := func(collection model.Collection) bool { return collection.Found }
+	return keepLastGood(c.Stale, c.store, "stale", found, loader)
+}
+
+func (c *Caches) keepLastUsers(loader BulkUserLoaderFunc) BulkUserLoaderFunc {
+	found := func(user model.UserInterests) bool { return user.Found }
+	return keepLastGood(c.StaleUsers, c.store, "staleuser", found, loader)
+}
+
+// GetCollection loads a collection through the cache. If loading fails, the
+// last good copy is returned instead, with stale set
+func (c *Caches) GetCollection(
+	ctx context.Context,
+	key string,
+	loader CollectionLoaderFunc,
+) (collection model.Collection, stale bool, err error) {
+	collections, stale, err := c.BulkGetCollections(ctx, []string{key}, bulkLoader(loader))
+	return collections[key], stale, err
+}
+
+// BulkGetCollections loads collections through the cache. If loading fails,
+// the last good copies are returned instead, with stale set. The error is
+// only returned if any of the collections have never loaded
+func (c *Caches) BulkGetCollections(
+	ctx context.Context,
+	keys []string,
+	loader BulkCollectionLoaderFunc,
+) (collections map[string]model.Collection, stale bool, err error) {
+	var restored restoredKeys
+	collections, err = c.Collections.BulkGet(
+		ctx,
+		keys,
+		throughStore(
+			c.store,
+			"collection",
+			collectionExpiry,
+			&restored,
+			c.keepLastCollections(loader),
+		),
+	)
+	restored.apply(c.Collections)
+	if err == nil {
+		return collections, false, nil
+	}
+	collections = make(map[string]model.Collection)
+	for _, key := range keys {
+		if collection, ok := c.Collections.GetIfPresent(key); ok {
+			collections[key] = collection
+			continue
+		}
+		collection, ok := lastGood(ctx, c.Stale, c.store, "stale", key)
+		if !ok {
+			return collections, stale, err
+		}
+		collections[key] = collection
+		stale = true
+	}
+	log.Warn().Err(err).Strs("keys", keys).Msg("Serving stale collections")
+	return collections, stale, nil
+}
+
+// GetUser loads a user's interests through the cache and the store. If
+// loading fails, the last good copy is returned instead, with stale set
+func (c *Caches) GetUser(
+	ctx context.Context,
+	key string,
+	loader UserLoaderFunc,
+) (user model.UserInterests, stale bool, err error) {
+	var restored restoredKeys
+	users, err := c.Users.BulkGet(
+		ctx,
+		[]string{key},
+		throughStore(c.store, "user", userExpiry, &restored, c.keepLastUsers(bulkLoader(loader))),
+	)
+	restored.apply(c.Users)
+	if err == nil {
+		return users[key], false, nil
+	}
+	user, ok := lastGood(ctx, c.StaleUsers, c.store, "staleuser", key)
+	if !ok {
+		return user, false, err
+	}
+	log.Warn().Err(err).Str("key", key).Msg("Serving stale user")
+	return user, true, nil
+}
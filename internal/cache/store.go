@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/maypok86/otter/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// Store keeps encoded cache entries outside of the in-memory caches, so they
+// survive restarts and can be shared between replicas
+type Store interface {
+	// Get returns ErrNotStored when the key is missing or has expired
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+var ErrNotStored = errors.New("key not in store")
+
+// OpenStore connects to the store set by CACHE_STORE, which is either
+// "memory", "disk" or a redis:// url. Without one, it returns nil, and caches
+// are only kept in memory and saved in snapshots
+func OpenStore() (Store, error) {
+	kind := config.CacheStore()
+	var store Store
+	var err error
+	switch {
+	case kind == "":
+		return nil, nil
+	case kind == "memory":
+		store = NewMemoryStore()
+	case kind == "disk":
+		store, err = NewDiskStore(path.Join(config.CacheStorage(), "store"))
+	case strings.HasPrefix(kind, "redis://"), strings.HasPrefix(kind, "rediss://"):
+		store, err = NewRedisStore(kind)
+	default:
+		err = fmt.Errorf("unknown cache store %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("store", strings.SplitN(kind, "@", 2)[0]).Msg("Opened cache store")
+	return store, nil
+}
+
+// stored is how values are encoded in the store, along with when they expire
+// so every replica expires them at the same time
+type stored[V any] struct {
+	Value   V
+	Expires time.Time
+}
+
+// storeKey namespaces keys by the schema of their values, so replicas running
+// releases with different models don't read each other's entries
+func storeKey[V any](name, key string) string {
+	return name + "/" + schemaOf[V]() + "/" + key
+}
+
+func storeGet[V any](
+	ctx context.Context,
+	store Store,
+	name, key string,
+) (entry stored[V], ok bool) {
+	if store == nil {
+		return entry, false
+	}
+	data, err := store.Get(ctx, storeKey[V](name, key))
+	if err != nil {
+		if !errors.Is(err, ErrNotStored) {
+			log.Warn().Err(err).Str("key", key).Msgf("Unable to read %s from store", name)
+		}
+		return entry, false
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		log.Warn().Err(err).Str("key", key).Msgf("Unable to decode %s from store", name)
+		return entry, false
+	}
+	return entry, time.Now().Before(entry.Expires)
+}
+
+func storeSet[V any](
+	ctx context.Context,
+	store Store,
+	name, key string,
+	value V,
+	ttl time.Duration,
+) {
+	if store == nil {
+		return
+	}
+	var data bytes.Buffer
+	entry := stored[V]{Value: value, Expires: time.Now().Add(ttl)}
+	if err := gob.NewEncoder(&data).Encode(entry); err != nil {
+		log.Warn().Err(err).Str("key", key).Msgf("Unable to encode %s for store", name)
+		return
+	}
+	if err := store.Set(ctx, storeKey[V](name, key), data.Bytes(), ttl); err != nil {
+		log.Warn().Err(err).Str("key", key).Msgf("Unable to write %s to store", name)
+	}
+}
+
+// restoredKeys records when the keys read from the store expire
+type restoredKeys struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func (r *restoredKeys) add(key string, expires time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.expires == nil {
+		r.expires = make(map[string]time.Time)
+	}
+	r.expires[key] = expires
+}
+
+// apply expires keys read from the store when they expire in the store, and
+// refreshes them shortly before
+func (r *restoredKeys) apply(cache interface {
+	SetExpiresAfter(key string, expiresAfter time.Duration)
+	SetRefreshableAfter(key string, refreshableAfter time.Duration)
+}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, expires := range r.expires {
+		remaining := time.Until(expires)
+		cache.SetExpiresAfter(key, remaining)
+		cache.SetRefreshableAfter(key, max(remaining-refreshLead, 0))
+	}
+}
+
+// throughStore wraps a bulk loader so keys are looked up in the store before
+// they're loaded, and anything loaded is written to the store. Reloads pass
+// nil for restored, as they replace what's in the store without reading it
+func throughStore[V any](
+	store Store,
+	name string,
+	ttl time.Duration,
+	restored *restoredKeys,
+	loader otter.BulkLoaderFunc[string, V],
+) otter.BulkLoaderFunc[string, V] {
+	return func(ctx context.Context, keys []string) (map[string]V, error) {
+		if store == nil {
+			return loader(ctx, keys)
+		}
+		result := make(map[string]V)
+		missing := keys
+		if restored != nil {
+			missing = nil
+			for _, key := range keys {
+				// entries that are about to expire are reloaded instead, so
+				// refreshing them doesn't just read them back
+				entry, ok := storeGet[V](ctx, store, name, key)
+				if !ok || time.Until(entry.Expires) <= refreshLead {
+					missing = append(missing, key)
+					continue
+				}
+				result[key] = entry.Value
+				restored.add(key, entry.Expires)
+			}
+			if len(missing) == 0 {
+				return result, nil
+			}
+		}
+		loaded, err := loader(ctx, missing)
+		for key, value := range loaded {
+			result[key] = value
+			storeSet(ctx, store, name, key, value, ttl)
+		}
+		return result, err
+	}
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestThroughStore(t *testing.T) {
+	tests := []struct {
+		name string
+		// stored is how long each key in the store has left
+		stored map[string]time.Duration
+		reload bool
+		keys   []string
+		loaded []string
+		want   map[string]string
+	}{
+		{
+			name:   "stored keys aren't loaded",
+			stored: map[string]time.Duration{"a": 12 * time.Hour, "b": 12 * time.Hour},
+			keys:   []string{"a", "b"},
+			want:   map[string]string{"a": "stored a", "b": "stored b"},
+		},
+		{
+			name:   "missing keys are loaded",
+			stored: map[string]time.Duration{"a": 12 * time.Hour},
+			keys:   []string{"a", "b"},
+			loaded: []string{"b"},
+			want:   map[string]string{"a": "stored a", "b": "loaded b"},
+		},
+		{
+			name:   "keys about to expire are loaded",
+			stored: map[string]time.Duration{"a": 12 * time.Hour, "b": refreshLead / 2},
+			keys:   []string{"a", "b"},
+			loaded: []string{"b"},
+			want:   map[string]string{"a": "stored a", "b": "loaded b"},
+		},
+		{
+			name:   "reloads don't read the store",
+			stored: map[string]time.Duration{"a": 12 * time.Hour},
+			reload: true,
+			keys:   []string{"a", "b"},
+			loaded: []string{"a", "b"},
+			want:   map[string]string{"a": "loaded a", "b": "loaded b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryStore()
+			for key, ttl := range test.stored {
+				storeSet(ctx, store, "test", key, "stored "+key, ttl)
+			}
+			var loaded []string
+			loader := func(ctx context.Context, keys []string) (map[string]string, error) {
+				loaded = append(loaded, keys...)
+				result := make(map[string]string)
+				for _, key := range keys {
+					result[key] = "loaded " + key
+				}
+				return result, nil
+			}
+			var restored *restoredKeys
+			if !test.reload {
+				restored = &restoredKeys{}
+			}
+
+			got, err := throughStore(store, "test", 12*time.Hour, restored, loader)(ctx, test.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+			slices.Sort(loaded)
+			if !slices.Equal(loaded, test.loaded) {
+				t.Errorf("expected %v to be loaded, got %v", test.loaded, loaded)
+			}
+
+			// everything loaded is written to the store
+			for key, value := range test.want {
+				entry, ok := storeGet[string](ctx, store, "test", key)
+				if !ok || entry.Value != value {
+					t.Errorf("expected %q to be stored for %s, got %q", value, key, entry.Value)
+				}
+			}
+			// only keys read from the store are restored
+			if restored != nil {
+				var keys []string
+				for key := range restored.expires {
+					keys = append(keys, key)
+				}
+				slices.Sort(keys)
+				var want []string
+				for _, key := range test.keys {
+					if !slices.Contains(test.loaded, key) {
+						want = append(want, key)
+					}
+				}
+				if !slices.Equal(keys, want) {
+					t.Errorf("expected %v to be restored, got %v", want, keys)
+				}
+			}
+		})
+	}
+}
+
+func TestThroughStoreLoadError(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	failure := errors.New("hardcover is down")
+	loader := func(ctx context.Context, keys []string) (map[string]string, error) {
+		return map[string]string{"a": "loaded a"}, failure
+	}
+
+	got, err := throughStore(store, "test", time.Hour, &restoredKeys{}, loader)(
+		ctx,
+		[]string{"a", "b"},
+	)
+	if !errors.Is(err, failure) {
+		t.Errorf("expected the load error, got %v", err)
+	}
+	if got["a"] != "loaded a" {
+		t.Errorf("expected the keys that loaded to be returned, got %v", got)
+	}
+	if entry, ok := storeGet[string](ctx, store, "test", "a"); !ok || entry.Value != "loaded a" {
+		t.Errorf("expected the keys that loaded to be stored, got %q", entry.Value)
+	}
+	if _, ok := storeGet[string](ctx, store, "test", "b"); ok {
+		t.Error("expected the key that failed not to be stored")
+	}
+}
+
+func TestThroughStoreWithoutStore(t *testing.T) {
+	calls := 0
+	loader := func(ctx context.Context, keys []string) (map[string]string, error) {
+		calls++
+		return map[string]string{"a": "loaded a"}, nil
+	}
+	load := throughStore(nil, "test", time.Hour, &restoredKeys{}, loader)
+	for range 2 {
+		got, err := load(context.Background(), []string{"a"})
+		if err != nil || got["a"] != "loaded a" {
+			t.Errorf("expected loaded a, got %v (%v)", got, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected every lookup to load without a store, got %d loads", calls)
+	}
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"iter"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/maypok86/otter/v2"
+)
+
+func newWebhookCache() *otter.Cache[string, model.Webhook] {
+	// subscriptions are never evicted, the number of webhooks is limited
+	// when they're registered instead
+	return otter.Must(&otter.Options[string, model.Webhook]{})
+}
+
+// SaveWebhook stores a webhook, writing it to disk straight away so
+// subscriptions aren't lost on restart
+func SaveWebhook(id string, webhook model.Webhook) {
+	WebhookCache.Set(id, webhook)
+	saveCache(WebhookCache, "webhook")
+}
+
+// DeleteWebhook removes a webhook, writing the change to disk
+func DeleteWebhook(id string) {
+	if _, ok := WebhookCache.Invalidate(id); ok {
+		saveCache(WebhookCache, "webhook")
+	}
+}
+
+func GetWebhook(id string) (model.Webhook, bool) {
+	return WebhookCache.GetIfPresent(id)
+}
+
+func WebhookCount() int {
+	return WebhookCache.EstimatedSize()
+}
+
+// Webhooks iterates over every registered webhook
+func Webhooks() iter.Seq2[string, model.Webhook] {
+	return WebhookCache.All()
+}
+
+// UpdateWebhooks replaces the stored state of webhooks after delivery, then
+// writes them to disk. Webhooks deleted since delivery started stay deleted
+func UpdateWebhooks(webhooks map[string]model.Webhook) {
+	for id, webhook := range webhooks {
+		WebhookCache.Compute(
+			id,
+			func(_ model.Webhook, found bool) (model.Webhook, otter.ComputeOp) {
+				if !found {
+					return webhook, otter.CancelOp
+				}
+				return webhook, otter.WriteOp
+			},
+		)
+	}
+	saveCache(WebhookCache, "webhook")
+}
@@ -0,0 +1,147 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const timeout = time.Minute
+
+// Client sends HTML emails through a SMTP server
+type Client struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewClient returns a client for the SMTP server at addr (host:port). Auth is
+// only used when a username is set
+func NewClient(addr, username, password, from string) *Client {
+	client := &Client{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		client.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return client
+}
+
+// Message is a HTML email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Html    string
+	// Headers are added to the email, e.g. List-Unsubscribe
+	Headers map[string]string
+}
+
+func headerValue(value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return "", errors.New("email headers can't contain line breaks")
+	}
+	return value, nil
+}
+
+func (c *Client) build(message Message) ([]byte, error) {
+	headers := [][2]string{
+		{"From", c.from},
+		{"To", message.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", message.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/html; charset=UTF-8"},
+		// SMTP limits lines to 998 octets, which rendered HTML can exceed
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	for _, key := range slices.Sorted(maps.Keys(message.Headers)) {
+		headers = append(headers, [2]string{key, message.Headers[key]})
+	}
+	var buf bytes.Buffer
+	for _, header := range headers {
+		value, err := headerValue(header[1])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s: %s\r\n", header[0], value)
+	}
+	buf.WriteString("\r\n")
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(message.Html)); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Send delivers the message through the SMTP server
+func (c *Client) Send(message Message) error {
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(c.from)
+	if err != nil {
+		return err
+	}
+	data, err := c.build(message)
+	if err != nil {
+		return err
+	}
+	return c.send(from.Address, to.Address, data)
+}
+
+// send is smtp.SendMail, with a timeout so a slow server can't block forever
+func (c *Client) send(from, to string, data []byte) error {
+	conn, err := net.DialTimeout("tcp", c.addr, timeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	host, _, _ := strings.Cut(c.addr, ":")
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if c.auth != nil {
+		if err := client.Auth(c.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,145 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/RobBrazier/bookfeed/internal/email/smtptest"
+)
+
+const from = "Bookfeed <bookfeed@example.com>"
+
+func newMessage(html string) Message {
+	return Message{
+		To:      "reader@example.com",
+		Subject: "Your weekly Bookfeed digest",
+		Html:    html,
+		Headers: map[string]string{
+			"List-Unsubscribe": "<https://bookfeed.example.com/digests/abc/unsubscribe>",
+		},
+	}
+}
+
+func TestSend(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+
+	// a single line of HTML, longer than SMTP allows
+	html := "<p>" + strings.Repeat("Mistborn: The Final Empire ", 200) + "&mdash; café</p>"
+	client := NewClient(server.Addr, "", "", from)
+	if err := client.Send(newMessage(html)); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	sent := messages[0]
+	if sent.From != "bookfeed@example.com" {
+		t.Errorf("expected to be sent from %q, got %q", "bookfeed@example.com", sent.From)
+	}
+	if len(sent.To) != 1 || sent.To[0] != "reader@example.com" {
+		t.Errorf("expected to be sent to %q, got %q", "reader@example.com", sent.To)
+	}
+	for i, line := range bytes.Split(sent.Data, []byte("\r\n")) {
+		if len(line) > 78 {
+			t.Errorf("line %d is %d octets long", i+1, len(line))
+		}
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(sent.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{
+		"Subject":                   "Your weekly Bookfeed digest",
+		"Content-Type":              "text/html; charset=UTF-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+		"List-Unsubscribe":          "<https://bookfeed.example.com/digests/abc/unsubscribe>",
+	}
+	for key, want := range headers {
+		value := parsed.Header.Get(key)
+		if key == "Subject" {
+			value, _ = new(mime.WordDecoder).DecodeHeader(value)
+		}
+		if value != want {
+			t.Errorf("expected %s header %q, got %q", key, want, value)
+		}
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the final line is terminated on the way through SMTP
+	if strings.TrimSuffix(string(body), "\r\n") != html {
+		t.Errorf("expected the decoded body to match the HTML, got %q", body)
+	}
+}
+
+func TestSendAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		sent     bool
+	}{
+		{name: "correct password", password: "hunter2", sent: true},
+		{name: "wrong password", password: "hunter3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := smtptest.NewAuthServer("bookfeed", "hunter2")
+			defer server.Close()
+
+			client := NewClient(server.Addr, "bookfeed", test.password, from)
+			err := client.Send(newMessage("<p>Hello</p>"))
+			if test.sent && err != nil {
+				t.Fatal(err)
+			}
+			if !test.sent && err == nil {
+				t.Error("expected sending to fail")
+			}
+			if sent := len(server.Messages()) == 1; sent != test.sent {
+				t.Errorf("expected sent to be %t, got %t", test.sent, sent)
+			}
+		})
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+	}{
+		{
+			name: "header",
+			message: Message{
+				To:      "reader@example.com",
+				Headers: map[string]string{"List-Unsubscribe": "<x>\r\nBcc: victim@example.com"},
+			},
+		},
+		{
+			name:    "recipient",
+			message: Message{To: "reader@example.com\r\nBcc: victim@example.com"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := smtptest.NewServer()
+			defer server.Close()
+
+			client := NewClient(server.Addr, "", "", from)
+			if err := client.Send(test.message); err == nil {
+				t.Error("expected the line break to be rejected")
+			}
+			if messages := server.Messages(); len(messages) != 0 {
+				t.Errorf("expected nothing to be sent, got %d messages", len(messages))
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package smtptest runs an in-process SMTP server for tests, which keeps the
+// messages it's sent rather than delivering them
+package smtptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Message is an email received by the server
+type Message struct {
+	From string
+	To   []string
+	// Data is the message as sent, headers and body
+	Data []byte
+}
+
+// Server is a SMTP server listening on a local port. It supports enough of
+// the protocol for net/smtp: EHLO, AUTH PLAIN, MAIL, RCPT, DATA and QUIT
+type Server struct {
+	// Addr is the host:port the server is listening on
+	Addr string
+
+	// username and password are required to send when username is set
+	username string
+	password string
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewServer starts a server, which should be closed when the test is done
+func NewServer() *Server {
+	return newServer("", "")
+}
+
+// NewAuthServer starts a server that requires the credentials to send
+func NewAuthServer(username, password string) *Server {
+	return newServer(username, password)
+}
+
+func newServer(username, password string) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("smtptest: failed to listen: %v", err))
+	}
+	s := &Server{
+		Addr:     listener.Addr().String(),
+		username: username,
+		password: password,
+		listener: listener,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close stops the server, waiting for open connections to finish
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+// Messages returns the messages received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(textproto.NewConn(conn))
+		}()
+	}
+}
+
+func (s *Server) handle(conn *textproto.Conn) {
+	username, password := s.username, s.password
+	authenticated := username == ""
+	var message Message
+	reply := func(format string, args ...any) bool {
+		return conn.PrintfLine(format, args...) == nil
+	}
+	if !reply("220 smtptest ready") {
+		return
+	}
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if username != "" {
+				reply("250-smtptest")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250 smtptest")
+			}
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(args, " ")
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			parts := bytes.Split(decoded, []byte{0})
+			switch {
+			case !strings.EqualFold(mechanism, "PLAIN"):
+				reply("504 unrecognised authentication type")
+			case err != nil || len(parts) != 3:
+				reply("501 malformed credentials")
+			case string(parts[1]) != username || string(parts[2]) != password:
+				reply("535 authentication failed")
+			default:
+				authenticated = true
+				reply("235 authenticated")
+			}
+		case "MAIL":
+			if !authenticated {
+				reply("530 authentication required")
+				continue
+			}
+			message = Message{From: address(args)}
+			reply("250 ok")
+		case "RCPT":
+			message.To = append(message.To, address(args))
+			reply("250 ok")
+		case "DATA":
+			if !reply("354 end data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, err := io.ReadAll(conn.DotReader())
+			if err != nil {
+				return
+			}
+			// DotReader normalises line endings to \n, so restore them
+			message.Data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "RSET":
+			message = Message{}
+			reply("250 ok")
+		case "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// address extracts the address from a MAIL FROM:<...> or RCPT TO:<...>
+func address(args string) string {
+	_, value, _ := strings.Cut(args, ":")
+	value, _, _ = strings.Cut(strings.TrimSpace(value), " ")
+	return strings.Trim(value, "<>")
+}
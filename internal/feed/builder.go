@@ -2,10 +2,13 @@ package feed
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/RobBrazier/bookfeed/internal/cache"
 	"github.com/RobBrazier/bookfeed/internal/model"
 	"github.com/RobBrazier/bookfeed/internal/view"
 	"github.com/RobBrazier/bookfeed/internal/view/feed"
@@ -16,24 +19,161 @@ import (
 
 type builder struct {
 	provider view.ProviderData
+	caches   *cache.Caches
+	// now is the clock release windows and feed history are based on
+	now func() time.Time
+}
+
+// Feed is a generated feed, along with the entry behind each of its items
+type Feed struct {
+	feeds.Feed
+	// Entries are keyed by item id
+	Entries map[string]model.Entry
+	// Stale is set when the provider couldn't be reached, and the feed was
+	// built from the last data that was loaded
+	Stale bool
 }
 
 type Builder interface {
-	GetRecentReleases(ctx context.Context) (feeds.Feed, error)
-	GetAuthorReleases(ctx context.Context, author string) (feeds.Feed, error)
-	GetSeriesReleases(ctx context.Context, series string) (feeds.Feed, error)
-	GetUserReleases(ctx context.Context, username, filter string) (feeds.Feed, error)
+	GetRecentReleases(ctx context.Context, opts Options) (Feed, error)
+	GetAuthorReleases(ctx context.Context, author string, opts Options) (Feed, error)
+	GetSeriesReleases(ctx context.Context, series string, opts Options) (Feed, error)
+	GetUserReleases(
+		ctx context.Context,
+		username, filter string,
+		opts Options,
+	) (Feed, error)
+	GetUserInterests(ctx context.Context, username, filter string) (model.UserInterests, error)
+	GetListReleases(ctx context.Context, username, list string, opts Options) (Feed, error)
+	GetPublisherReleases(
+		ctx context.Context,
+		publisher string,
+		imprints bool,
+		opts Options,
+	) (Feed, error)
+	GetGenreReleases(
+		ctx context.Context,
+		tags, exclude []string,
+		opts Options,
+	) (Feed, error)
+	GetMixReleases(
+		ctx context.Context,
+		authors, series, genres []string,
+		opts Options,
+	) (Feed, error)
+	ResolveNames(ctx context.Context, kind Kind, names []string) (map[string]model.Interest, error)
+	Search(ctx context.Context, kind Kind, query string) ([]model.SearchResult, error)
+}
+
+// ErrUnsupported is returned by a Builder for feed kinds its provider doesn't support
+var ErrUnsupported = errors.New("feed not supported by provider")
+
+func (b *builder) GetRecentReleases(ctx context.Context, opts Options) (Feed, error) {
+	return Feed{}, ErrUnsupported
+}
+
+func (b *builder) GetAuthorReleases(
+	ctx context.Context,
+	author string,
+	opts Options,
+) (Feed, error) {
+	return Feed{}, ErrUnsupported
+}
+
+func (b *builder) GetSeriesReleases(
+	ctx context.Context,
+	series string,
+	opts Options,
+) (Feed, error) {
+	return Feed{}, ErrUnsupported
+}
+
+func (b *builder) GetUserReleases(
+	ctx context.Context,
+	username, filter string,
+	opts Options,
+) (Feed, error) {
+	return Feed{}, ErrUnsupported
+}
+
+func (b *builder) GetUserInterests(
+	ctx context.Context,
+	username, filter string,
+) (model.UserInterests, error) {
+	return model.UserInterests{}, ErrUnsupported
+}
+
+func (b *builder) GetListReleases(
+	ctx context.Context,
+	username, list string,
+	opts Options,
+) (Feed, error) {
+	return Feed{}, ErrUnsupported
+}
+
+func (b *builder) GetPublisherReleases(
+	ctx context.Context,
+	publisher string,
+	imprints bool,
+	opts Options,
+) (Feed, error) {
+	return Feed{}, ErrUnsupported
+}
+
+func (b *builder) GetGenreReleases(
+	ctx context.Context,
+	tags, exclude []string,
+	opts Options,
+) (Feed, error) {
+	return Feed{}, ErrUnsupported
+}
+
+func (b *builder) GetMixReleases(
+	ctx context.Context,
+	authors, series, genres []string,
+	opts Options,
+) (Feed, error) {
+	return Feed{}, ErrUnsupported
+}
+
+func (b *builder) ResolveNames(
+	ctx context.Context,
+	kind Kind,
+	names []string,
+) (map[string]model.Interest, error) {
+	return nil, ErrUnsupported
+}
+
+func (b *builder) Search(
+	ctx context.Context,
+	kind Kind,
+	query string,
+) ([]model.SearchResult, error) {
+	return nil, ErrUnsupported
+}
+
+// itemDate returns the date a book was most recently released up until the end
+// of the feed - either its original release or a later edition being published
+func itemDate(book model.Book, until time.Time) (date time.Time) {
+	for _, event := range []time.Time{book.ReleaseDate, book.Edition.ReleaseDate} {
+		if event.After(date) && !event.After(until) {
+			date = event
+		}
+	}
+	return date
 }
 
 func (b *builder) buildFeed(
 	ctx context.Context,
-	title, link, description string,
+	key, title, link, description string,
 	created time.Time,
+	opts Options,
 	books []model.Book,
-) (feeds.Feed, error) {
+) (Feed, error) {
 	if description != "" {
 		description = "\n" + description
 	}
+	result := Feed{Entries: make(map[string]model.Entry)}
 	feed := &feeds.Feed{
 		Title:   title,
 		Link:    &feeds.Link{Href: link},
@@ -45,7 +185,17 @@ func (b *builder) buildFeed(
 		),
 		Updated: created,
 	}
+	var entries []model.Entry
 	for _, book := range books {
+		entries = append(entries, b.entries(book, created, opts)...)
+	}
+	// merge in entries from previous versions of the feed, so they aren't lost
+	// when they drop out of the release window
+	historyKey := fmt.Sprintf("%s%s", key, opts.Key())
+	entries = b.caches.RecordHistory(historyKey, entries, b.now().UTC())
+
+	for _, entry := range entries {
+		book := entry.Book
 		var authorName string
 		if len(book.Authors) > 0 {
 			authorName = book.Authors[0]
@@ -57,7 +207,7 @@ func (b *builder) buildFeed(
 				Type: "image/webp",
 			}
 		}
-		content, err := b.renderContent(ctx, book)
+		content, err := b.renderContent(ctx, book, entry.Upcoming)
 		if err != nil {
 			log.Error().
 				Err(err).
@@ -68,33 +218,137 @@ func (b *builder) buildFeed(
 		}
 
 		item := &feeds.Item{
-			Id:        strconv.Itoa(book.Id),
-			Title:     book.Title,
+			Id:        entry.Id,
+			Title:     entry.Title,
 			Link:      &feeds.Link{Href: book.Link},
 			Author:    &feeds.Author{Name: authorName},
 			Content:   content,
-			Created:   book.ReleaseDate,
+			Created:   entry.Date,
+			Updated:   entry.FirstSeen,
 			Enclosure: enclosure,
 		}
 		feed.Add(item)
+		result.Entries[entry.Id] = entry
 	}
 	feed.Sort(func(a, b *feeds.Item) bool {
 		return b.Created.Before(a.Created)
 	})
 
-	// Limit feed result size
-	maxItems := 25
-	if len(feed.Items) > maxItems {
-		feed.Items = feed.Items[:maxItems]
-	}
+	result.Feed = *feed
+	return result, nil
+}
+
+// newCollection creates a collection of books loaded now
+func (b *builder) newCollection(name, slug string, books []model.Book) model.Collection {
+	collection := model.NewCollection(name, slug, books)
+	collection.Created = b.now().UTC()
+	return collection
+}
 
-	return *feed, nil
+// markStale flags a feed built from the last data that was loaded, noting
+// in its description that it may be out of date
+func (b *builder) markStale(feed *Feed, created time.Time) {
+	feed.Stale = true
+	feed.Description = fmt.Sprintf(
+		"%s\n%s couldn't be reached, so this feed shows releases as of %s",
+		strings.TrimRight(feed.Description, "\n"),
+		b.provider.Title,
+		created.Format("02 Jan 2006 15:04:05 (-0700)"),
+	)
 }
 
-func (b *builder) renderContent(ctx context.Context, book model.Book) (string, error) {
+// entries returns the feed items for a book. A book can have more than one
+// entry, e.g. when it's added to a list and when it's released
+func (b *builder) entries(book model.Book, created time.Time, opts Options) []model.Entry {
+	id := strconv.Itoa(book.Id)
+	if opts.Calendar {
+		if book.ReleaseDate.IsZero() {
+			return nil
+		}
+		return []model.Entry{{
+			Id:       id,
+			Title:    book.Title,
+			Date:     book.ReleaseDate,
+			Upcoming: book.ReleaseDate.After(created),
+			Book:     book,
+		}}
+	}
+	if !opts.Upcoming {
+		_, until := opts.Window.Range(created, Period{})
+		published := itemDate(book, until)
+		var entries []model.Entry
+		if !book.Added.IsZero() && !book.Added.After(until) {
+			entries = append(entries, model.Entry{
+				Id:    fmt.Sprintf("%s/added", id),
+				Title: fmt.Sprintf("Added: %s", book.Title),
+				Date:  book.Added,
+				Book:  book,
+			})
+			// books that were already out when they were added only get the one item
+			if !published.After(book.Added) {
+				published = time.Time{}
+			}
+		}
+		if !published.IsZero() {
+			entries = append(entries, model.Entry{
+				Id:    id,
+				Title: book.Title,
+				Date:  published,
+				Book:  book,
+			})
+		}
+		for _, edition := range book.NewEditions {
+			if !edition.ReleaseDate.After(book.ReleaseDate) || edition.ReleaseDate.After(until) {
+				continue
+			}
+			editionBook := book
+			editionBook.Edition = edition
+			editionBook.NewEditions = nil
+			entries = append(entries, model.Entry{
+				Id:    fmt.Sprintf("%s/edition/%d", id, edition.Id),
+				Title: fmt.Sprintf("New Edition: %s", book.Title),
+				Date:  edition.ReleaseDate,
+				Book:  editionBook,
+			})
+		}
+		return entries
+	}
+	if book.ReleaseDate.After(created) {
+		announced := book.Announced
+		if announced.IsZero() || announced.After(created) {
+			announced = created
+		}
+		return []model.Entry{{
+			Id:       fmt.Sprintf("%s/upcoming", id),
+			Title:    fmt.Sprintf("Upcoming: %s", book.Title),
+			Date:     announced,
+			Upcoming: true,
+			Book:     book,
+		}}
+	}
+	if opts.Reminder && !book.ReleaseDate.IsZero() {
+		return []model.Entry{{
+			Id:    id,
+			Title: fmt.Sprintf("Out Now: %s", book.Title),
+			Date:  book.ReleaseDate,
+			Book:  book,
+		}}
+	}
+	return nil
+}
+
+func (b *builder) renderContent(
+	ctx context.Context,
+	book model.Book,
+	upcoming bool,
+) (string, error) {
 	buf := templ.GetBuffer()
 	defer templ.ReleaseBuffer(buf)
-	if err := feed.Feed(book, b.provider).Render(ctx, buf); err != nil {
+	component := feed.Feed(book, b.provider)
+	if upcoming {
+		component = feed.Upcoming(book, b.provider)
+	}
+	if err := component.Render(ctx, buf); err != nil {
 		return "", err
 	}
 	return buf.String(), nil
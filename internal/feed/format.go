@@ -6,4 +6,7 @@ const (
 	FORMAT_RSS  Format = "rss"
 	FORMAT_ATOM Format = "atom"
 	FORMAT_JSON Format = "json"
+	FORMAT_ICS  Format = "ics"
 )
+
+var Formats = []Format{FORMAT_JSON, FORMAT_ATOM, FORMAT_RSS, FORMAT_ICS}
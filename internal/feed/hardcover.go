@@ -2,12 +2,14 @@ package feed
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"maps"
 	"net/url"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Khan/genqlient/graphql"
@@ -16,12 +18,45 @@ import (
 	"github.com/RobBrazier/bookfeed/internal/hardcover"
 	"github.com/RobBrazier/bookfeed/internal/model"
 	"github.com/RobBrazier/bookfeed/internal/view/pages"
-	"github.com/gorilla/feeds"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
+func init() {
+	Register(Provider{
+		Prefix:     "hc",
+		Data:       pages.HardcoverProvider,
+		Page:       pages.Hardcover(),
+		ImportPage: pages.HardcoverImport(),
+		Kinds: []Kind{
+			KIND_RECENT,
+			KIND_AUTHOR,
+			KIND_SERIES,
+			KIND_USER,
+			KIND_LIST,
+			KIND_PUBLISHER,
+			KIND_GENRE,
+			KIND_MIX,
+		},
+		NewBuilder: func(deps Deps) Builder {
+			return NewHardcoverBuilder(
+				hardcover.GetClient(config.HardcoverToken()),
+				deps.Caches,
+				deps.Now,
+				HardcoverOptions{},
+			)
+		},
+	})
+}
+
+// reading_format_id values for each edition format
+var readingFormats = map[EditionFormat]int{
+	EDITION_PHYSICAL: 1,
+	EDITION_AUDIO:    2,
+	EDITION_EBOOK:    4,
+}
+
 type hardcoverBuilder struct {
 	builder
 	client       graphql.Client
@@ -62,6 +97,7 @@ func (b hardcoverBuilder) mapBook(source hardcover.Book) model.Book {
 		Link:        fmt.Sprintf("https://hardcover.app/books/%s", source.Slug),
 		Title:       source.Title,
 		ReleaseDate: source.ReleaseDate,
+		Announced:   source.CreatedAt,
 		Headline:    source.Headline,
 		Description: source.Description,
 		Compilation: source.Compilation,
@@ -75,6 +111,39 @@ func (b hardcoverBuilder) mapBook(source hardcover.Book) model.Book {
 	}
 }
 
+func (b hardcoverBuilder) mapEdition(source hardcover.Edition) model.Edition {
+	var narrators []string
+	for _, contributor := range source.Contributions {
+		if strings.EqualFold(contributor.Contribution, "narrator") {
+			narrators = append(narrators, contributor.Author.Name)
+		}
+	}
+	format := source.EditionFormat
+	if format == "" {
+		format = source.ReadingFormat.Format
+	}
+	return model.Edition{
+		Id:          source.Id,
+		ReleaseDate: source.ReleaseDate,
+		Format:      format,
+		Publisher:   source.Publisher.Name,
+		Narrators:   narrators,
+		Isbn13:      source.Isbn13,
+		Asin:        source.Asin,
+		Duration:    time.Duration(source.AudioSeconds) * time.Second,
+	}
+}
+
+// mapEditionBook maps a book using the release date of its (format specific) edition
+func (b hardcoverBuilder) mapEditionBook(source hardcover.EditionBook) model.Book {
+	book := b.mapBook(source.Book)
+	if len(source.Editions) > 0 {
+		book.Edition = b.mapEdition(source.Editions[0])
+		book.ReleaseDate = book.Edition.ReleaseDate
+	}
+	return book
+}
+
 func (b hardcoverBuilder) mapBooks(source []hardcover.Book) (books []model.Book) {
 	for _, book := range source {
 		books = append(books, b.mapBook(book))
@@ -86,56 +155,100 @@ func (b hardcoverBuilder) buildUrl(slug string) string {
 	return fmt.Sprintf("https://hardcover.app/%s", slug)
 }
 
-func (b *hardcoverBuilder) GetRecentReleases(ctx context.Context) (feeds.Feed, error) {
+func (b *hardcoverBuilder) GetRecentReleases(
+	ctx context.Context,
+	opts Options,
+) (Feed, error) {
 	loader := cache.CollectionLoaderFunc(
 		func(ctx context.Context, key string) (collection model.Collection, err error) {
-			now := time.Now()
-			lastMonth := now.AddDate(0, -1, 0)
+			now := b.now()
+			from, to := opts.Window.Range(now, Period{Months: 1})
 			log.Info().Msg("Fetching recent releases")
-			data, err := hardcover.RecentReleases(ctx, b.client, now, lastMonth)
+			data, err := hardcover.RecentReleases(ctx, b.client, to, from)
 			log.Info().Dur("elapsed", time.Since(now)).Msg("Retrieved recent releases data")
 			if err != nil {
 				return collection, err
 			}
 			books := b.mapBooks(data.Books)
-			return model.NewCollection("Recent", "upcoming/recent", books), nil
+			return b.newCollection("Recent", "upcoming/recent", books), nil
 		},
 	)
-	collection, err := cache.CollectionCache.Get(ctx, "hardcover/releases", loader)
+	key := fmt.Sprintf("hardcover/releases%s", opts.CacheKey())
+	b.caches.TrackCollection(key, loader)
+	collection, stale, err := b.caches.GetCollection(ctx, key, loader)
 	if err != nil {
-		return feeds.Feed{}, err
+		return Feed{}, err
 	}
-	return b.buildFeed(
+	result, err := b.buildFeed(
 		ctx,
+		"hardcover/releases",
 		"Hardcover: Recent Releases",
 		b.buildUrl(collection.Slug),
 		"",
 		collection.Created,
+		opts,
 		collection.Books,
 	)
+	if stale {
+		b.markStale(&result, collection.Created)
+	}
+	return result, err
 }
 
-func (b *hardcoverBuilder) authorLoader(ids ...int) cache.BulkCollectionLoaderFunc {
+func (b *hardcoverBuilder) authorLoader(
+	opts Options,
+	ids ...int,
+) cache.BulkCollectionLoaderFunc {
 	return cache.BulkCollectionLoaderFunc(
 		func(ctx context.Context, keys []string) (map[string]model.Collection, error) {
 			result := make(map[string]model.Collection)
-			now := time.Now()
-			earliest := now.AddDate(-1, 0, 0)
-			uncachedKeys := b.uncachedKeys(keys)
-			slugMapping := b.extractSlugs(uncachedKeys)
+			now := b.now()
+			earliest, latest := opts.Window.Range(now, Period{Years: 1})
+			slugMapping := b.extractSlugs(keys)
 			slugs := slices.Collect(maps.Keys(slugMapping))
 			log := log.With().
 				Strs("authors", slugs).
-				Strs("uncached", uncachedKeys).
+				Strs("keys", keys).
 				Ints("ids", ids).
 				Logger()
 			log.Info().Msg("Fetching releases")
+			add := func(name, slug string, books []model.Book) {
+				if cacheKey, ok := slugMapping[slug]; ok {
+					result[cacheKey] = b.newCollection(
+						name,
+						fmt.Sprintf("authors/%s", slug),
+						books,
+					)
+				}
+			}
 			var releases []hardcover.AuthorRelease
-			if len(ids) > 0 {
+			if format, ok := readingFormats[opts.Edition]; ok {
+				data, err := hardcover.AuthorEditionReleases(
+					ctx,
+					b.client,
+					latest,
+					earliest,
+					append([]string{}, slugs...),
+					append([]int{}, ids...),
+					format,
+					b.compilations,
+				)
+				if err != nil {
+					log.Error().Err(err).Msg("Error from hardcover AuthorEditionReleases")
+					return result, err
+				}
+				for _, author := range data.Authors {
+					var books []model.Book
+					for _, contribution := range author.Contributions {
+						books = append(books, b.mapEditionBook(contribution.Book))
+					}
+					add(author.Name, author.Slug, books)
+				}
+			} else if len(ids) > 0 {
 				data, err := hardcover.RecentAuthorReleasesById(
 					ctx,
 					b.client,
-					now,
+					latest,
 					earliest,
 					ids,
 					b.compilations,
@@ -149,7 +262,7 @@ func (b *hardcoverBuilder) authorLoader(ids ...int) cache.BulkCollectionLoaderFu
 				data, err := hardcover.RecentAuthorReleases(
 					ctx,
 					b.client,
-					now,
+					latest,
 					earliest,
 					slugs,
 					b.compilations,
@@ -162,22 +275,16 @@ func (b *hardcoverBuilder) authorLoader(ids ...int) cache.BulkCollectionLoaderFu
 			}
 			log.Info().Dur("elapsed", time.Since(now)).Msg("Retrieved author data")
 			for _, author := range releases {
-				if cacheKey, ok := slugMapping[author.Slug]; ok {
-					var books []model.Book
-					for _, contribution := range author.Contributions {
-						books = append(books, b.mapBook(contribution.Book))
-					}
-					result[cacheKey] = model.NewCollection(
-						author.Name,
-						fmt.Sprintf("authors/%s", author.Slug),
-						books,
-					)
+				var books []model.Book
+				for _, contribution := range author.Contributions {
+					books = append(books, b.mapBook(contribution.Book))
 				}
+				add(author.Name, author.Slug, books)
 			}
-			for _, uncachedKey := range uncachedKeys {
-				if _, ok := result[uncachedKey]; !ok {
+			for _, key := range keys {
+				if _, ok := result[key]; !ok {
 					// Prevent abuse from entry not found
-					result[uncachedKey] = model.Collection{}
+					result[key] = model.Collection{}
 				}
 			}
 			return result, nil
@@ -188,17 +295,19 @@ func (b *hardcoverBuilder) authorLoader(ids ...int) cache.BulkCollectionLoaderFu
 func (b *hardcoverBuilder) GetAuthorReleases(
 	ctx context.Context,
 	slug string,
-) (feed feeds.Feed, err error) {
-	loader := b.authorLoader()
-	key := fmt.Sprintf("hardcover/authors/%s", slug)
-	collections, err := cache.CollectionCache.BulkGet(
+	opts Options,
+) (feed Feed, err error) {
+	loader := b.authorLoader(opts)
+	key := fmt.Sprintf("hardcover/authors/%s%s", slug, opts.CacheKey())
+	b.caches.TrackCollections("authors"+opts.CacheKey(), []string{key}, loader)
+	collections, stale, err := b.caches.BulkGetCollections(
 		ctx,
 		[]string{key},
 		loader,
 	)
 	if err != nil {
 		log.Error().Err(err).Msgf("error retrieving author via cache, key=%s", key)
-		_, invalidated := cache.CollectionCache.Invalidate(key)
+		_, invalidated := b.caches.Collections.Invalidate(key)
 		if invalidated {
 			log.Info().Msgf("Invalidated cache for key=%s", key)
 		} else {
@@ -215,40 +324,75 @@ func (b *hardcoverBuilder) GetAuthorReleases(
 		return feed, fmt.Errorf("author not found")
 	}
 	title := fmt.Sprintf("Hardcover Author Releases: %s", collection.Name)
-	return b.buildFeed(
+	result, err := b.buildFeed(
 		ctx,
+		fmt.Sprintf("hardcover/authors/%s", slug),
 		title,
 		b.buildUrl(collection.Slug),
 		"",
 		collection.Created,
+		opts,
 		collection.Books,
 	)
+	if stale {
+		b.markStale(&result, collection.Created)
+	}
+	return result, err
 }
 
-func (b *hardcoverBuilder) seriesLoader(ids ...int) cache.BulkCollectionLoaderFunc {
+func (b *hardcoverBuilder) seriesLoader(
+	opts Options,
+	ids ...int,
+) cache.BulkCollectionLoaderFunc {
 	return cache.BulkCollectionLoaderFunc(
 		func(ctx context.Context, keys []string) (map[string]model.Collection, error) {
 			result := make(map[string]model.Collection)
-			now := time.Now()
-			earliest := now.AddDate(-1, 0, 0)
-			uncachedKeys := keys
-			if len(keys) > 1 {
-				uncachedKeys = b.uncachedKeys(keys)
-			}
-			slugMapping := b.extractSlugs(uncachedKeys)
+			now := b.now()
+			earliest, latest := opts.Window.Range(now, Period{Years: 1})
+			slugMapping := b.extractSlugs(keys)
 			slugs := slices.Collect(maps.Keys(slugMapping))
 			log := log.With().
 				Strs("series", slugs).
-				Strs("uncached", uncachedKeys).
+				Strs("keys", keys).
 				Ints("ids", ids).
 				Logger()
 			log.Info().Msg("Fetching releases")
+			add := func(name, slug string, books []model.Book) {
+				if cacheKey, ok := slugMapping[slug]; ok {
+					result[cacheKey] = b.newCollection(
+						name,
+						fmt.Sprintf("series/%s", slug),
+						books,
+					)
+				}
+			}
 			var releases []hardcover.SeriesRelease
-			if len(ids) > 0 {
+			if format, ok := readingFormats[opts.Edition]; ok {
+				data, err := hardcover.SeriesEditionReleases(
+					ctx,
+					b.client,
+					latest,
+					earliest,
+					append([]string{}, slugs...),
+					append([]int{}, ids...),
+					format,
+					b.compilations,
+				)
+				if err != nil {
+					return result, err
+				}
+				for _, series := range data.Series {
+					var books []model.Book
+					for _, book := range series.BookSeries {
+						books = append(books, b.mapEditionBook(book.Book))
+					}
+					add(series.Name, series.Slug, books)
+				}
+			} else if len(ids) > 0 {
 				data, err := hardcover.RecentSeriesReleasesById(
 					ctx,
 					b.client,
-					now,
+					latest,
 					earliest,
 					ids,
 					b.compilations,
@@ -261,7 +405,7 @@ func (b *hardcoverBuilder) seriesLoader(ids ...int) cache.BulkCollectionLoaderFu
 				data, err := hardcover.RecentSeriesReleases(
 					ctx,
 					b.client,
-					now,
+					latest,
 					earliest,
 					slugs,
 					b.compilations,
@@ -273,22 +417,16 @@ func (b *hardcoverBuilder) seriesLoader(ids ...int) cache.BulkCollectionLoaderFu
 			}
 			log.Info().Dur("elapsed", time.Since(now)).Msg("Retrieved series data")
 			for _, series := range releases {
-				if cacheKey, ok := slugMapping[series.Slug]; ok {
-					var books []model.Book
-					for _, book := range series.BookSeries {
-						books = append(books, b.mapBook(book.Book))
-					}
-					result[cacheKey] = model.NewCollection(
-						series.Name,
-						fmt.Sprintf("series/%s", series.Slug),
-						books,
-					)
+				var books []model.Book
+				for _, book := range series.BookSeries {
+					books = append(books, b.mapBook(book.Book))
 				}
+				add(series.Name, series.Slug, books)
 			}
-			for _, uncachedKey := range uncachedKeys {
-				if _, ok := result[uncachedKey]; !ok {
+			for _, key := range keys {
+				if _, ok := result[key]; !ok {
 					// Prevent abuse from entry not found
-					result[uncachedKey] = model.Collection{}
+					result[key] = model.Collection{}
 				}
 			}
 			return result, nil
@@ -299,17 +437,19 @@ func (b *hardcoverBuilder) seriesLoader(ids ...int) cache.BulkCollectionLoaderFu
 func (b *hardcoverBuilder) GetSeriesReleases(
 	ctx context.Context,
 	slug string,
-) (feed feeds.Feed, err error) {
-	loader := b.seriesLoader()
-	key := fmt.Sprintf("hardcover/series/%s", slug)
-	collections, err := cache.CollectionCache.BulkGet(
+	opts Options,
+) (feed Feed, err error) {
+	loader := b.seriesLoader(opts)
+	key := fmt.Sprintf("hardcover/series/%s%s", slug, opts.CacheKey())
+	b.caches.TrackCollections("series"+opts.CacheKey(), []string{key}, loader)
+	collections, stale, err := b.caches.BulkGetCollections(
 		ctx,
 		[]string{key},
 		loader,
 	)
 	if err != nil {
 		log.Error().Err(err).Msgf("error retrieving series via cache, key=%s", key)
-		_, invalidated := cache.CollectionCache.Invalidate(key)
+		_, invalidated := b.caches.Collections.Invalidate(key)
 		if invalidated {
 			log.Info().Msgf("Invalidated cache for key=%s", key)
 		} else {
@@ -325,24 +465,32 @@ func (b *hardcoverBuilder) GetSeriesReleases(
 		return feed, fmt.Errorf("series not found")
 	}
 	title := fmt.Sprintf("Hardcover Series Releases: %s", collection.Name)
-	return b.buildFeed(
+	result, err := b.buildFeed(
 		ctx,
+		fmt.Sprintf("hardcover/series/%s", slug),
 		title,
 		b.buildUrl(collection.Slug),
 		"",
 		collection.Created,
+		opts,
 		collection.Books,
 	)
+	if stale {
+		b.markStale(&result, collection.Created)
+	}
+	return result, err
 }
 
+// getUserInterests loads the authors and series a user reads. If Hardcover
+// can't be reached, the last interests loaded are returned with stale set
 func (b *hardcoverBuilder) getUserInterests(
 	ctx context.Context,
 	username string,
-) (model.UserInterests, error) {
+) (interests model.UserInterests, stale bool, err error) {
 	log := log.With().Str("user", username).Logger()
 	loader := cache.UserLoaderFunc(
 		func(ctx context.Context, key string) (interests model.UserInterests, err error) {
-			now := time.Now()
+			now := b.now()
 			earliest := now.AddDate(-2, 0, 0)
 			log.Info().Msg("Fetching user interests")
 			data, err := hardcover.UserInterests(ctx, b.client, username, earliest)
@@ -356,8 +504,8 @@ func (b *hardcoverBuilder) getUserInterests(
 			if len(data.Users) == 0 {
 				return interests, nil
 			}
-			authorMapping := make(map[string]int)
-			seriesMapping := make(map[string]int)
+			authorMapping := make(map[string]model.Interest)
+			seriesMapping := make(map[string]model.Interest)
 			authorCount := make(map[string]int)
 			seriesCount := make(map[string]int)
 			for _, book := range data.UserBooks {
@@ -368,12 +516,20 @@ func (b *hardcoverBuilder) getUserInterests(
 					) {
 						slug := contribution.Author.Slug
 						authorCount[slug]++
-						authorMapping[slug] = contribution.Author.Id
+						authorMapping[slug] = model.Interest{
+							Slug: slug,
+							Id:   contribution.Author.Id,
+							Name: contribution.Author.Name,
+						}
 					}
 				}
 				if slug := book.Book.FeaturedSeries.Series.Slug; slug != "" {
 					seriesCount[slug]++
-					seriesMapping[slug] = book.Book.FeaturedSeries.Series.Id
+					seriesMapping[slug] = model.Interest{
+						Slug: slug,
+						Id:   book.Book.FeaturedSeries.Series.Id,
+						Name: book.Book.FeaturedSeries.Series.Name,
+					}
 				}
 			}
 			var authors []model.Interest
@@ -382,18 +538,12 @@ func (b *hardcoverBuilder) getUserInterests(
 			// only check feeds for authors that have > 1 book read
 			for slug, count := range authorCount {
 				if count > 1 {
-					authors = append(authors, model.Interest{
-						Slug: slug,
-						Id:   authorMapping[slug],
-					})
+					authors = append(authors, authorMapping[slug])
 				}
 			}
 			for slug, count := range seriesCount {
 				if count > 1 {
-					series = append(series, model.Interest{
-						Slug: slug,
-						Id:   seriesMapping[slug],
-					})
+					series = append(series, seriesMapping[slug])
 				}
 			}
 
@@ -401,25 +551,148 @@ func (b *hardcoverBuilder) getUserInterests(
 				Series:  series,
 				Authors: authors,
 				Found:   true,
+				Created: now.UTC(),
 			}, nil
 		},
 	)
-	return cache.UserCache.Get(ctx, fmt.Sprintf("hardcover/user/%s", username), loader)
+	key := fmt.Sprintf("hardcover/user/%s", username)
+	b.caches.TrackUser(key, loader)
+	return b.caches.GetUser(ctx, key, loader)
 }
 
-func (b hardcoverBuilder) uncachedKeys(keys []string) (result []string) {
-	for _, key := range keys {
-		if _, ok := cache.CollectionCache.GetIfPresent(key); !ok {
-			result = append(result, key)
+// GetUserInterests returns the authors and series behind a user's releases
+// feed, limited by the same filter. The wishlist has neither, so only the
+// user is checked
+func (b *hardcoverBuilder) GetUserInterests(
+	ctx context.Context,
+	username, filter string,
+) (model.UserInterests, error) {
+	if filter == "wishlist" {
+		wishlist, _, err := b.getUserWishlist(ctx, username, Window{})
+		if err != nil {
+			return model.UserInterests{}, err
+		}
+		if !wishlist.Found {
+			return model.UserInterests{}, fmt.Errorf("user not found")
 		}
+		return model.UserInterests{Found: true}, nil
+	}
+	interests, _, err := b.getUserInterests(ctx, username)
+	if err != nil {
+		return model.UserInterests{}, err
+	}
+	if !interests.Found {
+		return model.UserInterests{}, fmt.Errorf("user not found")
 	}
+	result := model.UserInterests{Found: true}
+	if slices.Contains([]string{"", "author"}, filter) {
+		result.Authors = sortInterests(interests.Authors)
+	}
+	if slices.Contains([]string{"", "series"}, filter) {
+		result.Series = sortInterests(interests.Series)
+	}
+	return result, nil
+}
+
+// sortInterests returns a copy of the interests sorted by name, falling back to
+// the slug for interests cached before names were recorded
+func sortInterests(interests []model.Interest) []model.Interest {
+	result := slices.Clone(interests)
+	for i, interest := range result {
+		if interest.Name == "" {
+			result[i].Name = interest.Slug
+		}
+	}
+	slices.SortFunc(result, func(a, b model.Interest) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
 	return result
 }
 
+func (b *hardcoverBuilder) getUserWishlist(
+	ctx context.Context,
+	username string,
+	window Window,
+) (wishlist model.UserInterests, stale bool, err error) {
+	log := log.With().Str("user", username).Logger()
+	loader := cache.UserLoaderFunc(
+		func(ctx context.Context, key string) (interests model.UserInterests, err error) {
+			now := b.now()
+			earliest, latest := window.Range(now, Period{Years: 1})
+			log.Info().Msg("Fetching user wishlist")
+			data, err := hardcover.UserWishlist(ctx, b.client, username, latest, earliest)
+			log.Info().
+				Dur("elapsed", time.Since(now)).
+				Int("count", len(data.UserBooks)).
+				Msg("Retrieved user wishlist")
+			if err != nil {
+				return interests, err
+			}
+			if len(data.Users) == 0 {
+				return interests, nil
+			}
+			var books []model.Book
+			for _, userBook := range data.UserBooks {
+				book := b.mapBook(userBook.Book.Book)
+				// only interested in editions published after the original release
+				for _, edition := range userBook.Book.LatestEditions {
+					if edition.ReleaseDate.After(book.ReleaseDate) {
+						book.NewEditions = append(book.NewEditions, b.mapEdition(edition))
+					}
+				}
+				books = append(books, book)
+			}
+			return model.UserInterests{
+				Books:   books,
+				Found:   true,
+				Created: now.UTC(),
+			}, nil
+		},
+	)
+	key := fmt.Sprintf("hardcover/user/%s/wishlist%s", username, window.Key())
+	b.caches.TrackUser(key, loader)
+	return b.caches.GetUser(ctx, key, loader)
+}
+
+func (b *hardcoverBuilder) getWishlistReleases(
+	ctx context.Context,
+	username string,
+	opts Options,
+) (Feed, error) {
+	wishlist, stale, err := b.getUserWishlist(ctx, username, opts.Window)
+	if err != nil {
+		return Feed{}, err
+	}
+	if !wishlist.Found {
+		return Feed{}, fmt.Errorf("user not found")
+	}
+
+	slug := fmt.Sprintf("@%s", username)
+	// Books on the shelf may not be released yet, so the feed is evaluated
+	// against the current time rather than when the shelf was cached
+	collection := b.newCollection(username, slug, wishlist.Books)
+
+	title := fmt.Sprintf("Hardcover Want to Read Releases: %s", username)
+	result, err := b.buildFeed(
+		ctx,
+		fmt.Sprintf("hardcover/user/%s/wishlist", username),
+		title,
+		b.buildUrl(slug),
+		"Includes New Releases and Editions from the Want to Read shelf",
+		collection.Created,
+		opts,
+		collection.Books,
+	)
+	if stale {
+		b.markStale(&result, wishlist.Created)
+	}
+	return result, err
+}
+
 func (b hardcoverBuilder) extractSlugs(keys []string) map[string]string {
 	result := make(map[string]string)
 	for _, key := range keys {
-		slug := key[strings.LastIndex(key, "/")+1:]
+		slug, _, _ := strings.Cut(key[strings.LastIndex(key, "/")+1:], "?")
 		result[slug] = key
 	}
 	return result
@@ -429,6 +702,7 @@ func (b hardcoverBuilder) collectKeys(
 	collect bool,
 	key string,
 	items []model.Interest,
+	opts Options,
 	builder *strings.Builder,
 ) ([]string, []int) {
 	if !collect || len(items) == 0 {
@@ -446,24 +720,107 @@ func (b hardcoverBuilder) collectKeys(
 
 	fmt.Fprintf(builder, "%s: %s\n", title, strings.Join(slugs, ", "))
 
+	return b.slugKeys(key, slugs, opts), ids
+}
+
+func (b hardcoverBuilder) slugKeys(key string, slugs []string, opts Options) []string {
 	var keys []string
-	for _, item := range slugs {
-		keys = append(keys, fmt.Sprintf("hardcover/%s/%s", key, item))
+	for _, slug := range slugs {
+		keys = append(keys, fmt.Sprintf("hardcover/%s/%s%s", key, slug, opts.CacheKey()))
+	}
+	return keys
+}
+
+type releaseJob struct {
+	key    string
+	keys   []string
+	loader cache.BulkCollectionLoaderFunc
+}
+
+// collectReleases loads the collections for each job concurrently, and merges
+// their books into a single list without duplicates. If any of them could
+// only be served stale, asOf is when the oldest of those was loaded. An error
+// is returned if any of them have never loaded, as the feed would be missing
+// their books
+func (b *hardcoverBuilder) collectReleases(
+	ctx context.Context,
+	jobs []releaseJob,
+) (books []model.Book, asOf time.Time, stale bool, err error) {
+	var wg sync.WaitGroup
+	results := sync.Map{}
+	var anyStale atomic.Bool
+	errs := make([]error, len(jobs))
+	wg.Add(len(jobs))
+	for i, job := range jobs {
+		go func() {
+			defer wg.Done()
+			result, stale, err := b.caches.BulkGetCollections(ctx, job.keys, job.loader)
+			if err != nil {
+				errs[i] = fmt.Errorf("unable to fetch %s data: %w", job.key, err)
+				return
+			}
+			if stale {
+				anyStale.Store(true)
+			}
+			for key, value := range result {
+				results.Store(key, value)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, asOf, false, err
+	}
+
+	collections := make(map[string]model.Collection)
+	for _, job := range jobs {
+		for _, key := range job.keys {
+			value, ok := results.Load(key)
+			log := log.With().Str("key", key).Logger()
+			if !ok {
+				log.Warn().Msg("key not found in collected collections")
+				continue
+			}
+			collection, ok := value.(model.Collection)
+			if !ok {
+				log.Warn().Msg("value not Collection type")
+				continue
+			}
+			collections[key] = collection
+		}
 	}
-	return keys, ids
+
+	bookMapping := make(map[int]model.Book)
+
+	stale = anyStale.Load()
+	for _, collection := range collections {
+		if stale && (asOf.IsZero() || collection.Created.Before(asOf)) {
+			asOf = collection.Created
+		}
+		for _, book := range collection.Books {
+			if _, ok := bookMapping[book.Id]; !ok {
+				bookMapping[book.Id] = book
+			}
+		}
+	}
+	return slices.Collect(maps.Values(bookMapping)), asOf, stale, nil
 }
 
 func (b *hardcoverBuilder) GetUserReleases(
 	ctx context.Context,
 	username, filter string,
-) (feeds.Feed, error) {
+	opts Options,
+) (Feed, error) {
 	log := log.With().Str("user", username).Str("filter", filter).Logger()
-	interests, err := b.getUserInterests(ctx, username)
+	if filter == "wishlist" {
+		return b.getWishlistReleases(ctx, username, opts)
+	}
+	interests, interestsStale, err := b.getUserInterests(ctx, username)
 	if err != nil {
-		return feeds.Feed{}, err
+		return Feed{}, err
 	}
 	if !interests.Found {
-		return feeds.Feed{}, fmt.Errorf("user not found")
+		return Feed{}, fmt.Errorf("user not found")
 	}
 
 	log.Info().Interface("interests", interests).Msg("Getting releases for interests")
@@ -475,6 +832,7 @@ func (b *hardcoverBuilder) GetUserReleases(
 		slices.Contains([]string{"", "series"}, filter),
 		"series",
 		interests.Series,
+		opts,
 		&descBuilder,
 	)
 
@@ -482,99 +840,599 @@ func (b *hardcoverBuilder) GetUserReleases(
 		slices.Contains([]string{"", "author"}, filter),
 		"authors",
 		interests.Authors,
+		opts,
 		&descBuilder,
 	)
 
-	type job struct {
-		key    string
-		keys   []string
-		loader cache.BulkCollectionLoaderFunc
-	}
-	jobs := []job{}
+	// the ids are only known from the user's history, so reloading in the
+	// background uses the slugs
+	b.caches.TrackCollections("series"+opts.CacheKey(), seriesKeys, b.seriesLoader(opts))
+	b.caches.TrackCollections("authors"+opts.CacheKey(), authorKeys, b.authorLoader(opts))
+
+	jobs := []releaseJob{}
 	if len(seriesKeys) > 0 {
-		jobs = append(jobs, job{
+		jobs = append(jobs, releaseJob{
 			key:    "series",
 			keys:   seriesKeys,
-			loader: b.seriesLoader(seriesIds...),
+			loader: b.seriesLoader(opts, seriesIds...),
 		})
 	}
 	if len(authorKeys) > 0 {
-		jobs = append(jobs, job{
+		jobs = append(jobs, releaseJob{
 			key:    "author",
 			keys:   authorKeys,
-			loader: b.authorLoader(authorIds...),
+			loader: b.authorLoader(opts, authorIds...),
 		})
 	}
+	books, asOf, stale, err := b.collectReleases(ctx, jobs)
+	if err != nil {
+		return Feed{}, err
+	}
+	if interestsStale && (!stale || interests.Created.Before(asOf)) {
+		stale, asOf = true, interests.Created
+	}
 
-	var wg sync.WaitGroup
-	results := sync.Map{}
-	wg.Add(len(jobs))
-	for _, job := range jobs {
-		go func() {
-			defer wg.Done()
-			result, err := cache.CollectionCache.BulkGet(ctx, job.keys, job.loader)
+	slug := fmt.Sprintf("@%s", username)
+	collection := b.newCollection(username, slug, books)
+
+	title := fmt.Sprintf("Hardcover User Releases: %s", username)
+	result, err := b.buildFeed(
+		ctx,
+		fmt.Sprintf("hardcover/user/%s/%s", username, filter),
+		title,
+		b.buildUrl(slug),
+		descBuilder.String(),
+		collection.Created,
+		opts,
+		collection.Books,
+	)
+	if stale {
+		b.markStale(&result, asOf)
+	}
+	return result, err
+}
+
+func (b *hardcoverBuilder) GetListReleases(
+	ctx context.Context,
+	username, list string,
+	opts Options,
+) (Feed, error) {
+	log := log.With().Str("user", username).Str("list", list).Logger()
+	loader := cache.CollectionLoaderFunc(
+		func(ctx context.Context, key string) (collection model.Collection, err error) {
+			now := b.now()
+			earliest, latest := opts.Window.Range(now, Period{Years: 1})
+			log.Info().Msg("Fetching list releases")
+			data, err := hardcover.ListReleases(ctx, b.client, latest, earliest, username, list)
+			log.Info().Dur("elapsed", time.Since(now)).Msg("Retrieved list data")
 			if err != nil {
-				log.Error().Err(err).Msgf("Unable to fetch %s data", job.key)
+				return collection, err
 			}
-			for key, value := range result {
-				results.Store(key, value)
+			if len(data.Lists) == 0 {
+				// Prevent abuse from entry not found
+				return model.Collection{}, nil
 			}
-		}()
+			source := data.Lists[0]
+			bookMapping := make(map[int]model.Book)
+			for _, item := range slices.Concat(source.Added, source.Released) {
+				if _, ok := bookMapping[item.Book.Id]; ok {
+					continue
+				}
+				book := b.mapBook(item.Book)
+				book.Added = item.DateAdded
+				bookMapping[book.Id] = book
+			}
+			books := slices.Collect(maps.Values(bookMapping))
+			return b.newCollection(
+				source.Name,
+				fmt.Sprintf("@%s/lists/%s", username, source.Slug),
+				books,
+			), nil
+		},
+	)
+	key := fmt.Sprintf("hardcover/lists/%s/%s%s", username, list, opts.CacheKey())
+	b.caches.TrackCollection(key, loader)
+	collection, stale, err := b.caches.GetCollection(ctx, key, loader)
+	if err != nil {
+		return Feed{}, err
 	}
-	wg.Wait()
-	keys := []string{}
-	keys = append(keys, seriesKeys...)
-	keys = append(keys, authorKeys...)
+	if !collection.Found {
+		return Feed{}, fmt.Errorf("list not found")
+	}
+	title := fmt.Sprintf("Hardcover List Releases: %s", collection.Name)
+	result, err := b.buildFeed(
+		ctx,
+		fmt.Sprintf("hardcover/lists/%s/%s", username, list),
+		title,
+		b.buildUrl(collection.Slug),
+		"Includes books added to the list, and new releases from books on the list",
+		collection.Created,
+		opts,
+		collection.Books,
+	)
+	if stale {
+		b.markStale(&result, collection.Created)
+	}
+	return result, err
+}
 
-	collections := make(map[string]model.Collection)
-	for _, key := range keys {
-		value, ok := results.Load(key)
-		log := log.With().Str("key", key).Logger()
-		if !ok {
-			log.Warn().Msg("key not found in collected collections")
-			continue
-		}
-		collection, ok := value.(model.Collection)
-		if !ok {
-			log.Warn().Msg("value not Collection type")
-			continue
-		}
-		collections[key] = collection
+func (b *hardcoverBuilder) GetPublisherReleases(
+	ctx context.Context,
+	slug string,
+	imprints bool,
+	opts Options,
+) (Feed, error) {
+	log := log.With().Str("publisher", slug).Bool("imprints", imprints).Logger()
+	loader := cache.CollectionLoaderFunc(
+		func(ctx context.Context, key string) (collection model.Collection, err error) {
+			now := b.now()
+			earliest, latest := opts.Window.Range(now, Period{Years: 1})
+			parents := []string{}
+			if imprints {
+				parents = append(parents, slug)
+			}
+			log.Info().Msg("Fetching publisher releases")
+			data, err := hardcover.PublisherReleases(
+				ctx,
+				b.client,
+				latest,
+				earliest,
+				[]string{slug},
+				parents,
+				b.compilations,
+			)
+			log.Info().Dur("elapsed", time.Since(now)).Msg("Retrieved publisher data")
+			if err != nil {
+				return collection, err
+			}
+			if len(data.Publishers) == 0 {
+				// Prevent abuse from entry not found
+				return model.Collection{}, nil
+			}
+			publisher := data.Publishers[0]
+			// editions are ordered by release date, so keep the latest for each book
+			bookMapping := make(map[int]model.Book)
+			for _, edition := range data.Editions {
+				if _, ok := bookMapping[edition.Book.Id]; ok {
+					continue
+				}
+				book := b.mapBook(edition.Book)
+				book.Edition = b.mapEdition(edition.Edition)
+				book.ReleaseDate = book.Edition.ReleaseDate
+				bookMapping[book.Id] = book
+			}
+			books := slices.Collect(maps.Values(bookMapping))
+			return b.newCollection(
+				publisher.Name,
+				fmt.Sprintf("publishers/%s", publisher.Slug),
+				books,
+			), nil
+		},
+	)
+	key := fmt.Sprintf("hardcover/publishers/%s", slug)
+	if imprints {
+		key += "/imprints"
+	}
+	b.caches.TrackCollection(key+opts.CacheKey(), loader)
+	collection, stale, err := b.caches.GetCollection(ctx, key+opts.CacheKey(), loader)
+	if err != nil {
+		return Feed{}, err
+	}
+	if !collection.Found {
+		return Feed{}, fmt.Errorf("publisher not found")
+	}
+	title := fmt.Sprintf("Hardcover Publisher Releases: %s", collection.Name)
+	var description string
+	if imprints {
+		description = "Includes New Releases from imprints of the publisher"
+	}
+	result, err := b.buildFeed(
+		ctx,
+		key,
+		title,
+		b.buildUrl(collection.Slug),
+		description,
+		collection.Created,
+		opts,
+		collection.Books,
+	)
+	if stale {
+		b.markStale(&result, collection.Created)
 	}
+	return result, err
+}
 
-	bookMapping := make(map[int]model.Book)
+func (b hardcoverBuilder) genreKey(tags, exclude []string) string {
+	key := fmt.Sprintf("hardcover/genres/%s", strings.Join(tags, ","))
+	if len(exclude) > 0 {
+		key += fmt.Sprintf("/exclude/%s", strings.Join(exclude, ","))
+	}
+	return key
+}
 
-	for _, collection := range collections {
-		for _, book := range collection.Books {
-			if _, ok := bookMapping[book.Id]; !ok {
-				bookMapping[book.Id] = book
+func (b *hardcoverBuilder) genreLoader(
+	tags, exclude []string,
+	opts Options,
+) cache.CollectionLoaderFunc {
+	log := log.With().Strs("tags", tags).Strs("exclude", exclude).Logger()
+	return cache.CollectionLoaderFunc(
+		func(ctx context.Context, key string) (collection model.Collection, err error) {
+			now := b.now()
+			from, to := opts.Window.Range(now, Period{Months: 1})
+			log.Info().Msg("Fetching genre releases")
+			data, err := hardcover.GenreReleases(
+				ctx,
+				b.client,
+				to,
+				from,
+				append([]string{}, tags...),
+				// a null _in would exclude every tagged book
+				append([]string{}, exclude...),
+			)
+			log.Info().Dur("elapsed", time.Since(now)).Msg("Retrieved genre releases data")
+			if err != nil {
+				return collection, err
 			}
-		}
+			if len(data.Tags) == 0 {
+				// Prevent abuse from entry not found
+				return model.Collection{}, nil
+			}
+			var names []string
+			for _, tag := range data.Tags {
+				names = append(names, tag.Tag)
+			}
+			books := b.mapBooks(data.Books)
+			return b.newCollection(
+				strings.Join(names, ", "),
+				fmt.Sprintf("genres/%s", data.Tags[0].Slug),
+				books,
+			), nil
+		},
+	)
+}
+
+// genresLoader loads each genre separately, so they share cache entries with
+// the single genre feeds
+func (b *hardcoverBuilder) genresLoader(opts Options) cache.BulkCollectionLoaderFunc {
+	return cache.BulkCollectionLoaderFunc(
+		func(ctx context.Context, keys []string) (map[string]model.Collection, error) {
+			result := make(map[string]model.Collection)
+			for tag, key := range b.extractSlugs(keys) {
+				collection, err := b.genreLoader([]string{tag}, nil, opts).Load(ctx, key)
+				if err != nil {
+					return result, err
+				}
+				result[key] = collection
+			}
+			return result, nil
+		},
+	)
+}
+
+func (b *hardcoverBuilder) GetGenreReleases(
+	ctx context.Context,
+	tags, exclude []string,
+	opts Options,
+) (Feed, error) {
+	key := b.genreKey(tags, exclude)
+	loader := b.genreLoader(tags, exclude, opts)
+	b.caches.TrackCollection(key+opts.CacheKey(), loader)
+	collection, stale, err := b.caches.GetCollection(ctx, key+opts.CacheKey(), loader)
+	if err != nil {
+		return Feed{}, err
+	}
+	if !collection.Found {
+		return Feed{}, fmt.Errorf("genre not found")
+	}
+	var description string
+	if len(exclude) > 0 {
+		description = fmt.Sprintf("Excludes books tagged with: %s", strings.Join(exclude, ", "))
+	}
+	result, err := b.buildFeed(
+		ctx,
+		key,
+		fmt.Sprintf("Hardcover Genre Releases: %s", collection.Name),
+		b.buildUrl(collection.Slug),
+		description,
+		collection.Created,
+		opts,
+		collection.Books,
+	)
+	if stale {
+		b.markStale(&result, collection.Created)
 	}
-	books := slices.Collect(maps.Values(bookMapping))
+	return result, err
+}
 
-	slug := fmt.Sprintf("@%s", username)
-	collection := model.NewCollection(username, slug, books)
+func (b *hardcoverBuilder) GetMixReleases(
+	ctx context.Context,
+	authors, series, genres []string,
+	opts Options,
+) (Feed, error) {
+	log.Info().
+		Strs("authors", authors).
+		Strs("series", series).
+		Strs("genres", genres).
+		Msg("Getting releases for mix")
 
-	title := fmt.Sprintf("Hardcover User Releases: %s", username)
-	return b.buildFeed(
+	var descBuilder strings.Builder
+	descBuilder.WriteString("Includes New Releases from:\n")
+	caser := cases.Title(language.English)
+	key := "hardcover/mix"
+	jobs := []releaseJob{}
+	for _, part := range []struct {
+		key    string
+		slugs  []string
+		loader cache.BulkCollectionLoaderFunc
+	}{
+		{"series", series, b.seriesLoader(opts)},
+		{"authors", authors, b.authorLoader(opts)},
+		{"genres", genres, b.genresLoader(opts)},
+	} {
+		if len(part.slugs) == 0 {
+			continue
+		}
+		fmt.Fprintf(&descBuilder, "%s: %s\n", caser.String(part.key), strings.Join(part.slugs, ", "))
+		key += fmt.Sprintf("/%s/%s", part.key, strings.Join(part.slugs, ","))
+		keys := b.slugKeys(part.key, part.slugs, opts)
+		b.caches.TrackCollections(part.key+opts.CacheKey(), keys, part.loader)
+		jobs = append(jobs, releaseJob{
+			key:    part.key,
+			keys:   keys,
+			loader: part.loader,
+		})
+	}
+	books, asOf, stale, err := b.collectReleases(ctx, jobs)
+	if err != nil {
+		return Feed{}, err
+	}
+	collection := b.newCollection("Mix", "", books)
+
+	result, err := b.buildFeed(
 		ctx,
-		title,
-		b.buildUrl(slug),
+		key,
+		"Hardcover Mixed Releases",
+		b.buildUrl(collection.Slug),
 		descBuilder.String(),
 		collection.Created,
+		opts,
 		collection.Books,
 	)
+	if stale {
+		b.markStale(&result, asOf)
+	}
+	return result, err
+}
+
+const (
+	// maxNameSearches limits how many names are looked up with the search API
+	// when they don't exactly match an author or series
+	maxNameSearches = 25
+	// nameSearchWorkers limits how many of those searches run at once
+	nameSearchWorkers = 5
+)
+
+// searchTypes are the search query types for each kind that can be searched
+var searchTypes = map[Kind]string{
+	KIND_AUTHOR: "Author",
+	KIND_SERIES: "Series",
+}
+
+// searchIds returns the ids of the best matches for a query, best first
+func (b *hardcoverBuilder) searchIds(
+	ctx context.Context,
+	kind Kind,
+	query string,
+	limit int,
+) ([]int, error) {
+	data, err := hardcover.Search(ctx, b.client, query, searchTypes[kind], limit)
+	if err != nil {
+		return nil, err
+	}
+	return data.Search.Ids, nil
+}
+
+// lookupIds returns the authors or series with the given ids, in the same
+// order as the ids
+func (b *hardcoverBuilder) lookupIds(
+	ctx context.Context,
+	kind Kind,
+	ids []int,
+) ([]model.SearchResult, error) {
+	var results []model.SearchResult
+	switch kind {
+	case KIND_AUTHOR:
+		data, err := hardcover.AuthorsById(ctx, b.client, append([]int{}, ids...))
+		if err != nil {
+			return nil, err
+		}
+		for _, author := range data.Authors {
+			results = append(results, model.SearchResult{
+				Id:         author.Id,
+				Slug:       author.Slug,
+				Name:       author.Name,
+				Image:      author.Image.Url,
+				BooksCount: author.BooksCount,
+			})
+		}
+	case KIND_SERIES:
+		data, err := hardcover.SeriesById(ctx, b.client, append([]int{}, ids...))
+		if err != nil {
+			return nil, err
+		}
+		for _, series := range data.Series {
+			result := model.SearchResult{
+				Id:         series.Id,
+				Slug:       series.Slug,
+				Name:       series.Name,
+				BooksCount: series.BooksCount,
+			}
+			if len(series.BookSeries) > 0 {
+				result.Image = series.BookSeries[0].Book.Image.Url
+			}
+			results = append(results, result)
+		}
+	default:
+		return nil, ErrUnsupported
+	}
+	// some results may not have slugs yet, which can't be used for feeds
+	results = slices.DeleteFunc(results, func(result model.SearchResult) bool {
+		return result.Slug == ""
+	})
+	slices.SortFunc(results, func(a, b model.SearchResult) int {
+		return slices.Index(ids, a.Id) - slices.Index(ids, b.Id)
+	})
+	return results, nil
+}
+
+// maxSearchResults limits how many results a search returns
+const maxSearchResults = 10
+
+// Search finds the authors or series best matching a query
+func (b *hardcoverBuilder) Search(
+	ctx context.Context,
+	kind Kind,
+	query string,
+) ([]model.SearchResult, error) {
+	if _, ok := searchTypes[kind]; !ok {
+		return nil, ErrUnsupported
+	}
+	query = strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	log := log.With().Str("kind", string(kind)).Str("query", query).Logger()
+	loader := cache.SearchLoaderFunc(
+		func(ctx context.Context, key string) ([]model.SearchResult, error) {
+			now := time.Now()
+			ids, err := b.searchIds(ctx, kind, query, maxSearchResults)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				return []model.SearchResult{}, nil
+			}
+			results, err := b.lookupIds(ctx, kind, ids)
+			log.Info().
+				Dur("elapsed", time.Since(now)).
+				Int("count", len(results)).
+				Msg("Searched")
+			return results, err
+		},
+	)
+	return b.caches.Search.Get(ctx, fmt.Sprintf("hardcover/search/%s/%s", kind, query), loader)
+}
+
+// ResolveNames finds the author or series for each name, preferring an exact
+// match and falling back to the top search result. Names that can't be found
+// are left out of the result
+func (b *hardcoverBuilder) ResolveNames(
+	ctx context.Context,
+	kind Kind,
+	names []string,
+) (map[string]model.Interest, error) {
+	log := log.With().Str("kind", string(kind)).Int("names", len(names)).Logger()
+	now := time.Now()
+	var matches []model.Interest
+	switch kind {
+	case KIND_AUTHOR:
+		data, err := hardcover.AuthorsByName(ctx, b.client, append([]string{}, names...))
+		if err != nil {
+			return nil, err
+		}
+		for _, author := range data.Authors {
+			matches = append(matches, model.Interest{Slug: author.Slug, Id: author.Id, Name: author.Name})
+		}
+	case KIND_SERIES:
+		data, err := hardcover.SeriesByName(ctx, b.client, append([]string{}, names...))
+		if err != nil {
+			return nil, err
+		}
+		for _, series := range data.Series {
+			matches = append(matches, model.Interest{Slug: series.Slug, Id: series.Id, Name: series.Name})
+		}
+	default:
+		return nil, ErrUnsupported
+	}
+	result := make(map[string]model.Interest)
+	// matches are ordered by popularity, so keep the first for each name
+	for _, match := range matches {
+		if _, ok := result[match.Name]; !ok && match.Slug != "" {
+			result[match.Name] = match
+		}
+	}
+
+	var unmatched []string
+	for _, name := range names {
+		if _, ok := result[name]; !ok && len(unmatched) < maxNameSearches {
+			unmatched = append(unmatched, name)
+		}
+	}
+	// tops holds the top search result for each unmatched name, or 0 if
+	// nothing was found
+	tops := make([]int, len(unmatched))
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, nameSearchWorkers)
+	for i, name := range unmatched {
+		wg.Go(func() {
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			ids, err := b.searchIds(ctx, kind, name, 1)
+			if err != nil {
+				log.Warn().Err(err).Str("name", name).Msg("Unable to search for name")
+				return
+			}
+			if len(ids) > 0 {
+				tops[i] = ids[0]
+			}
+		})
+	}
+	wg.Wait()
+
+	// searched holds the names whose top search result is each id, as
+	// different spellings can find the same author or series
+	searched := make(map[int][]string)
+	for i, id := range tops {
+		if id != 0 {
+			searched[id] = append(searched[id], unmatched[i])
+		}
+	}
+	if len(searched) > 0 {
+		found, err := b.lookupIds(ctx, kind, slices.Collect(maps.Keys(searched)))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range found {
+			for _, name := range searched[match.Id] {
+				result[name] = model.Interest{Slug: match.Slug, Id: match.Id, Name: match.Name}
+			}
+		}
+	}
+	log.Info().
+		Dur("elapsed", time.Since(now)).
+		Int("resolved", len(result)).
+		Msg("Resolved names")
+	return result, nil
+}
+
+// HardcoverOptions change which books are included in Hardcover feeds
+type HardcoverOptions struct {
+	// Compilations includes books marked as compilations, such as box sets
+	Compilations bool
 }
 
-func NewHardcoverBuilder() Builder {
-	token := config.HardcoverToken()
-	client := hardcover.GetClient(token)
+// NewHardcoverBuilder creates a builder that loads releases with the client,
+// keeping them in caches. now is the clock release windows are based on
+func NewHardcoverBuilder(
+	client graphql.Client,
+	caches *cache.Caches,
+	now func() time.Time,
+	opts HardcoverOptions,
+) Builder {
 	return &hardcoverBuilder{
 		client:       client,
-		compilations: false,
+		compilations: opts.Compilations,
 		builder: builder{
 			provider: pages.HardcoverProvider,
+			caches:   caches,
+			now:      now,
 		},
 	}
 }
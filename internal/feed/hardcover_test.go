@@ -0,0 +1,495 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/hardcover/hardcovertest"
+	"github.com/RobBrazier/bookfeed/internal/model"
+)
+
+var hcNow = time.Date(2025, 11, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestHardcoverBuilder(t *testing.T, client *hardcovertest.Client) Builder {
+	t.Helper()
+	return NewHardcoverBuilder(
+		client,
+		cache.NewCaches(nil),
+		func() time.Time { return hcNow },
+		HardcoverOptions{},
+	)
+}
+
+func TestResolveNames(t *testing.T) {
+	authors := map[int]string{
+		1: `{"id": 1, "name": "Brandon Sanderson", "slug": "brandon-sanderson"}`,
+		2: `{"id": 2, "name": "Robin Hobb", "slug": "robin-hobb"}`,
+	}
+	authorsByName := func(variables map[string]any) (string, error) {
+		if slices.Contains(variables["names"].([]any), any("Brandon Sanderson")) {
+			return `{"authors": [` + authors[1] + `]}`, nil
+		}
+		return `{"authors": []}`, nil
+	}
+	// searches find the author whose name starts the same, if any
+	search := func(variables map[string]any) (string, error) {
+		query := strings.ToLower(variables["query"].(string))
+		for id, name := range map[int]string{1: "brandon", 2: "robin"} {
+			if strings.HasPrefix(query, name) {
+				return fmt.Sprintf(`{"search": {"ids": [%d]}}`, id), nil
+			}
+		}
+		return `{"search": {"ids": []}}`, nil
+	}
+	authorsById := func(variables map[string]any) (string, error) {
+		var found []string
+		for _, id := range variables["ids"].([]any) {
+			found = append(found, authors[int(id.(float64))])
+		}
+		return fmt.Sprintf(`{"authors": [%s]}`, strings.Join(found, ",")), nil
+	}
+	unknown := make([]string, 30)
+	for i := range unknown {
+		unknown[i] = fmt.Sprintf("Unknown Author %d", i)
+	}
+
+	tests := []struct {
+		name     string
+		names    []string
+		want     map[string]string
+		searches int
+	}{
+		{
+			name:  "exact matches aren't searched",
+			names: []string{"Brandon Sanderson"},
+			want:  map[string]string{"Brandon Sanderson": "brandon-sanderson"},
+		},
+		{
+			name:  "names that find the same author",
+			names: []string{"Brandon Sanderson", "Brandon Sandersen", "brandon sanderson"},
+			want: map[string]string{
+				"Brandon Sanderson": "brandon-sanderson",
+				"Brandon Sandersen": "brandon-sanderson",
+				"brandon sanderson": "brandon-sanderson",
+			},
+			searches: 2,
+		},
+		{
+			name:     "searches are limited when nothing is found",
+			names:    append(slices.Clone(unknown), "Robin Hob"),
+			want:     map[string]string{},
+			searches: maxNameSearches,
+		},
+		{
+			name:     "searches are limited",
+			names:    append([]string{"Robin Hob"}, unknown...),
+			want:     map[string]string{"Robin Hob": "robin-hobb"},
+			searches: maxNameSearches,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := hardcovertest.NewClient(map[string]hardcovertest.Response{
+				"AuthorsByName": authorsByName,
+				"Search":        search,
+				"AuthorsById":   authorsById,
+			})
+			builder := newTestHardcoverBuilder(t, client)
+			resolved, err := builder.ResolveNames(context.Background(), KIND_AUTHOR, test.names)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for name, interest := range resolved {
+				got[name] = interest.Slug
+			}
+			if !maps.Equal(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+			if searches := len(client.Requests("Search")); searches != test.searches {
+				t.Errorf("expected %d searches, got %d", test.searches, searches)
+			}
+		})
+	}
+}
+
+func TestResolveNamesSearchesConcurrently(t *testing.T) {
+	var running, most atomic.Int32
+	search := func(variables map[string]any) (string, error) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := most.Load()
+			if now <= previous || most.CompareAndSwap(previous, now) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return `{"search": {"ids": []}}`, nil
+	}
+	client := hardcovertest.NewClient(map[string]hardcovertest.Response{
+		"AuthorsByName": hardcovertest.Respond(`{"authors": []}`),
+		"Search":        search,
+	})
+	names := make([]string, 3*nameSearchWorkers)
+	for i := range names {
+		names[i] = fmt.Sprintf("Unknown Author %d", i)
+	}
+
+	builder := newTestHardcoverBuilder(t, client)
+	if _, err := builder.ResolveNames(context.Background(), KIND_AUTHOR, names); err != nil {
+		t.Fatal(err)
+	}
+	if searches := len(client.Requests("Search")); searches != len(names) {
+		t.Errorf("expected %d searches, got %d", len(names), searches)
+	}
+	if most := most.Load(); most < 2 || most > nameSearchWorkers {
+		t.Errorf("expected between 2 and %d searches at once, got %d", nameSearchWorkers, most)
+	}
+}
+
+func readHardcoverFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("../hardcover/testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// newFixtureClient answers the release queries for authors and series from
+// the fixtures
+func newFixtureClient(t *testing.T) *hardcovertest.Client {
+	t.Helper()
+	authors := readHardcoverFixture(t, "authors.json")
+	series := readHardcoverFixture(t, "series.json")
+	return hardcovertest.NewClient(map[string]hardcovertest.Response{
+		"RecentAuthorReleases":     hardcovertest.Matching(authors, "authors"),
+		"RecentAuthorReleasesById": hardcovertest.Matching(authors, "authors"),
+		"AuthorEditionReleases": hardcovertest.Matching(
+			readHardcoverFixture(t, "author_editions.json"),
+			"authors",
+		),
+		"RecentSeriesReleases":     hardcovertest.Matching(series, "series"),
+		"RecentSeriesReleasesById": hardcovertest.Matching(series, "series"),
+		"SeriesEditionReleases": hardcovertest.Matching(
+			readHardcoverFixture(t, "series_editions.json"),
+			"series",
+		),
+		"UserInterests": hardcovertest.Respond(
+			string(readHardcoverFixture(t, "user_interests.json")),
+		),
+	})
+}
+
+// bookIds returns the ids of the books in a collection, in order
+func bookIds(collection model.Collection) []int {
+	var ids []int
+	for _, book := range collection.Books {
+		ids = append(ids, book.Id)
+	}
+	return ids
+}
+
+type loaderTest struct {
+	name string
+	opts Options
+	ids  []int
+	keys []string
+	// op is the only query expected to be made, with vars among its variables
+	op   string
+	vars map[string]any
+	// want is the ids of the books loaded for each key, or nil if the key
+	// wasn't found
+	want map[string][]int
+	fail bool
+}
+
+func runLoaderTests(
+	t *testing.T,
+	tests []loaderTest,
+	loader func(b *hardcoverBuilder, opts Options, ids ...int) cache.BulkCollectionLoaderFunc,
+) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFixtureClient(t)
+			if test.fail {
+				client.Fail(errors.New("hardcover is down"))
+			}
+			builder := newTestHardcoverBuilder(t, client).(*hardcoverBuilder)
+			collections, err := loader(builder, test.opts, test.ids...)(
+				context.Background(),
+				test.keys,
+			)
+			if test.fail {
+				if err == nil {
+					t.Error("expected the load to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			requests := client.Requests(test.op)
+			if len(requests) != 1 {
+				t.Fatalf("expected one %s query, got %d", test.op, len(requests))
+			}
+			for name, want := range test.vars {
+				if got := requests[0][name]; !reflect.DeepEqual(got, want) {
+					t.Errorf("expected %s to be %v, got %v", name, want, got)
+				}
+			}
+
+			if len(collections) != len(test.keys) {
+				t.Errorf("expected a collection for each key, got %v", collections)
+			}
+			for _, key := range test.keys {
+				collection := collections[key]
+				want, found := test.want[key]
+				if collection.Found != found {
+					t.Errorf("expected %s found to be %v", key, found)
+					continue
+				}
+				if !found {
+					continue
+				}
+				if ids := bookIds(collection); !slices.Equal(ids, want) {
+					t.Errorf("expected %s to have books %v, got %v", key, want, ids)
+				}
+				if !collection.Created.Equal(hcNow) {
+					t.Errorf("expected %s to be created now, got %s", key, collection.Created)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorLoader(t *testing.T) {
+	sanderson := "hardcover/authors/brandon-sanderson"
+	hobb := "hardcover/authors/robin-hobb"
+	runLoaderTests(t, []loaderTest{
+		{
+			name: "slugs",
+			keys: []string{sanderson, hobb, "hardcover/authors/nobody"},
+			op:   "RecentAuthorReleases",
+			vars: map[string]any{"from": "2024-11-01", "to": "2025-11-01"},
+			want: map[string][]int{sanderson: {103, 102, 101}, hobb: {201}},
+		},
+		{
+			name: "ids",
+			ids:  []int{2},
+			keys: []string{hobb},
+			op:   "RecentAuthorReleasesById",
+			vars: map[string]any{"ids": []any{float64(2)}},
+			want: map[string][]int{hobb: {201}},
+		},
+		{
+			name: "window",
+			opts: Options{Window: Window{Since: "P1M", Until: "P2Y"}},
+			keys: []string{hobb + "?since=P1M&until=P2Y"},
+			op:   "RecentAuthorReleases",
+			vars: map[string]any{"from": "2025-10-01", "to": "2027-11-01"},
+			want: map[string][]int{hobb + "?since=P1M&until=P2Y": {201}},
+		},
+		{
+			name: "edition format",
+			opts: Options{Edition: EDITION_AUDIO},
+			keys: []string{sanderson + "?format=audio"},
+			op:   "AuthorEditionReleases",
+			vars: map[string]any{
+				"slug":   []any{"brandon-sanderson"},
+				"format": float64(readingFormats[EDITION_AUDIO]),
+			},
+			want: map[string][]int{sanderson + "?format=audio": {101}},
+		},
+		{
+			name: "hardcover fails",
+			keys: []string{sanderson},
+			fail: true,
+		},
+	}, (*hardcoverBuilder).authorLoader)
+}
+
+func TestSeriesLoader(t *testing.T) {
+	stormlight := "hardcover/series/the-stormlight-archive"
+	runLoaderTests(t, []loaderTest{
+		{
+			name: "slugs",
+			keys: []string{stormlight, "hardcover/series/nothing"},
+			op:   "RecentSeriesReleases",
+			vars: map[string]any{"from": "2024-11-01", "to": "2025-11-01"},
+			want: map[string][]int{stormlight: {103, 101}},
+		},
+		{
+			name: "ids",
+			ids:  []int{10},
+			keys: []string{stormlight},
+			op:   "RecentSeriesReleasesById",
+			vars: map[string]any{"ids": []any{float64(10)}},
+			want: map[string][]int{stormlight: {103, 101}},
+		},
+		{
+			name: "edition format",
+			opts: Options{Edition: EDITION_AUDIO},
+			keys: []string{stormlight + "?format=audio"},
+			op:   "SeriesEditionReleases",
+			vars: map[string]any{
+				"slug":   []any{"the-stormlight-archive"},
+				"format": float64(readingFormats[EDITION_AUDIO]),
+			},
+			want: map[string][]int{stormlight + "?format=audio": {101}},
+		},
+		{
+			name: "hardcover fails",
+			keys: []string{stormlight},
+			fail: true,
+		},
+	}, (*hardcoverBuilder).seriesLoader)
+}
+
+func TestEditionLoadersUseEditionRelease(t *testing.T) {
+	client := newFixtureClient(t)
+	builder := newTestHardcoverBuilder(t, client).(*hardcoverBuilder)
+	key := "hardcover/authors/brandon-sanderson?format=audio"
+	collections, err := builder.authorLoader(Options{Edition: EDITION_AUDIO})(
+		context.Background(),
+		[]string{key},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := collections[key].Books[0]
+	if want := time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC); !book.ReleaseDate.Equal(want) {
+		t.Errorf("expected the audiobook's release date %s, got %s", want, book.ReleaseDate)
+	}
+	narrators := []string{"Michael Kramer"}
+	if book.Edition.Format != "Audible Audio" || !slices.Equal(book.Edition.Narrators, narrators) {
+		t.Errorf("expected the audiobook edition, got %+v", book.Edition)
+	}
+}
+
+func TestGetUserReleases(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		opts   Options
+		// books are the ids of the books in the feed, and queries the
+		// queries made for them
+		books   []int
+		queries []string
+		desc    []string
+		err     string
+	}{
+		{
+			name:    "authors and series",
+			books:   []int{101, 102},
+			queries: []string{"RecentAuthorReleasesById", "RecentSeriesReleasesById"},
+			desc:    []string{"Series: the-stormlight-archive", "Authors: brandon-sanderson"},
+		},
+		{
+			name:    "authors",
+			filter:  "author",
+			books:   []int{101, 102},
+			queries: []string{"RecentAuthorReleasesById"},
+			desc:    []string{"Authors: brandon-sanderson"},
+		},
+		{
+			name:    "series",
+			filter:  "series",
+			books:   []int{101},
+			queries: []string{"RecentSeriesReleasesById"},
+			desc:    []string{"Series: the-stormlight-archive"},
+		},
+		{
+			name:    "upcoming",
+			filter:  "series",
+			opts:    Options{Window: Window{Since: "P0D", Until: "P2Y"}, Upcoming: true},
+			books:   []int{103},
+			queries: []string{"RecentSeriesReleasesById"},
+		},
+		{
+			name:    "edition format",
+			filter:  "author",
+			opts:    Options{Edition: EDITION_AUDIO},
+			books:   []int{101},
+			queries: []string{"AuthorEditionReleases"},
+		},
+		{
+			name: "user not found",
+			err:  "user not found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFixtureClient(t)
+			if test.err == "user not found" {
+				client = hardcovertest.NewClient(map[string]hardcovertest.Response{
+					"UserInterests": hardcovertest.Respond(`{"users": [], "userBooks": []}`),
+				})
+			}
+			builder := newTestHardcoverBuilder(t, client)
+			result, err := builder.GetUserReleases(
+				context.Background(),
+				"reader",
+				test.filter,
+				test.opts,
+			)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var books []int
+			for _, entry := range result.Entries {
+				books = append(books, entry.Book.Id)
+			}
+			slices.Sort(books)
+			books = slices.Compact(books)
+			if !slices.Equal(books, test.books) {
+				t.Errorf("expected books %v, got %v", test.books, books)
+			}
+			for _, op := range []string{
+				"RecentAuthorReleases",
+				"RecentAuthorReleasesById",
+				"AuthorEditionReleases",
+				"RecentSeriesReleases",
+				"RecentSeriesReleasesById",
+				"SeriesEditionReleases",
+			} {
+				want := 0
+				if slices.Contains(test.queries, op) {
+					want = 1
+				}
+				if got := len(client.Requests(op)); got != want {
+					t.Errorf("expected %d %s queries, got %d", want, op, got)
+				}
+			}
+			for _, line := range test.desc {
+				if !strings.Contains(result.Description, line) {
+					t.Errorf("expected the description to include %q, got %q",
+						line, result.Description)
+				}
+			}
+			if result.Stale {
+				t.Error("expected the feed not to be stale")
+			}
+		})
+	}
+}
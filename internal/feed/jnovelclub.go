@@ -0,0 +1,252 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/jnovelclub"
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/RobBrazier/bookfeed/internal/view/pages"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	Register(Provider{
+		Prefix: "jnc",
+		Data:   pages.JnovelClubProvider,
+		Page:   pages.JNovelClub(),
+		Kinds: []Kind{
+			KIND_RECENT,
+			KIND_SERIES,
+		},
+		NewBuilder: func(deps Deps) Builder {
+			return NewJNovelClubBuilder(jnovelclub.GetClient(), deps.Caches, deps.Now)
+		},
+	})
+}
+
+// number of most recent volumes to include individual part releases for
+const jncRecentVolumes = 2
+
+type jnovelclubBuilder struct {
+	builder
+	client *jnovelclub.Client
+}
+
+// bookId derives a stable numeric id, as J-Novel Club only exposes string ids
+func (b jnovelclubBuilder) bookId(kind, slug string) int {
+	hash := fnv.New32a()
+	_, _ = fmt.Fprintf(hash, "%s/%s", kind, slug)
+	return int(hash.Sum32())
+}
+
+func (b jnovelclubBuilder) buildUrl(slug string) string {
+	return fmt.Sprintf("https://j-novel.club/%s", slug)
+}
+
+func (b jnovelclubBuilder) authors(creators []jnovelclub.Creator) (authors []string) {
+	for _, creator := range creators {
+		if strings.EqualFold(creator.Role, "author") {
+			authors = append(authors, creator.Name)
+		}
+	}
+	return authors
+}
+
+func (b jnovelclubBuilder) mapVolume(
+	series jnovelclub.Series,
+	volume jnovelclub.Volume,
+) model.Book {
+	return model.Book{
+		Id:          b.bookId("volume", volume.Slug),
+		Slug:        volume.Slug,
+		Link:        b.buildUrl(fmt.Sprintf("series/%s#volume-%d", series.Slug, volume.Number)),
+		Title:       volume.Title,
+		ReleaseDate: volume.Publishing,
+		Headline:    volume.ShortDescription,
+		Description: volume.Description,
+		Genres:      series.Tags,
+		Authors:     b.authors(volume.Creators),
+		Image:       model.Image{Url: volume.Cover.CoverUrl},
+		Series: model.Series{
+			Title:    series.Title,
+			Position: float32(volume.Number),
+		},
+	}
+}
+
+func (b jnovelclubBuilder) mapPart(
+	series jnovelclub.Series,
+	volume jnovelclub.Volume,
+	part jnovelclub.Part,
+) model.Book {
+	return model.Book{
+		Id:          b.bookId("part", part.Slug),
+		Slug:        part.Slug,
+		Link:        b.buildUrl(fmt.Sprintf("read/%s", part.Slug)),
+		Title:       part.Title,
+		ReleaseDate: part.Launch,
+		Genres:      series.Tags,
+		Authors:     b.authors(volume.Creators),
+		Image:       model.Image{Url: part.Cover.CoverUrl},
+		Series: model.Series{
+			Title:    series.Title,
+			Position: float32(volume.Number),
+		},
+	}
+}
+
+func (b jnovelclubBuilder) mapEvent(event jnovelclub.Event) model.Book {
+	return model.Book{
+		Id:          b.bookId("event", event.LinkFragment),
+		Slug:        strings.TrimPrefix(event.LinkFragment, "/"),
+		Link:        b.buildUrl(strings.TrimPrefix(event.LinkFragment, "/")),
+		Title:       strings.TrimSpace(fmt.Sprintf("%s %s", event.Name, event.Number)),
+		ReleaseDate: event.Launch,
+		Description: event.Details,
+		Image:       model.Image{Url: event.Cover.CoverUrl},
+	}
+}
+
+func (b *jnovelclubBuilder) GetRecentReleases(
+	ctx context.Context,
+	opts Options,
+) (Feed, error) {
+	loader := cache.CollectionLoaderFunc(
+		func(ctx context.Context, key string) (collection model.Collection, err error) {
+			now := b.now()
+			from, to := opts.Window.Range(now, Period{Months: 1})
+			log.Info().Msg("Fetching recent releases")
+			events, err := b.client.Events(ctx, from, to)
+			log.Info().Dur("elapsed", time.Since(now)).Msg("Retrieved recent releases data")
+			if err != nil {
+				return collection, err
+			}
+			var books []model.Book
+			for _, event := range events {
+				books = append(books, b.mapEvent(event))
+			}
+			return b.newCollection("Recent", "calendar", books), nil
+		},
+	)
+	key := fmt.Sprintf("jnovelclub/releases%s", opts.CacheKey())
+	b.caches.TrackCollection(key, loader)
+	collection, stale, err := b.caches.GetCollection(ctx, key, loader)
+	if err != nil {
+		return Feed{}, err
+	}
+	result, err := b.buildFeed(
+		ctx,
+		"jnovelclub/releases",
+		"J-Novel Club: Recent Releases",
+		b.buildUrl(collection.Slug),
+		"",
+		collection.Created,
+		opts,
+		collection.Books,
+	)
+	if stale {
+		b.markStale(&result, collection.Created)
+	}
+	return result, err
+}
+
+func (b *jnovelclubBuilder) GetSeriesReleases(
+	ctx context.Context,
+	slug string,
+	opts Options,
+) (Feed, error) {
+	log := log.With().Str("series", slug).Logger()
+	loader := cache.CollectionLoaderFunc(
+		func(ctx context.Context, key string) (collection model.Collection, err error) {
+			now := b.now()
+			log.Info().Msg("Fetching releases")
+			series, err := b.client.Series(ctx, slug)
+			if errors.Is(err, jnovelclub.ErrNotFound) {
+				// Prevent abuse from entry not found
+				return model.Collection{}, nil
+			}
+			if err != nil {
+				return collection, err
+			}
+			volumes, err := b.client.SeriesVolumes(ctx, slug)
+			if err != nil {
+				return collection, err
+			}
+			var books []model.Book
+			for _, volume := range volumes {
+				books = append(books, b.mapVolume(series, volume))
+			}
+			// parts are only released for the most recent volumes
+			for _, volume := range volumes[max(0, len(volumes)-jncRecentVolumes):] {
+				parts, err := b.client.VolumeParts(ctx, volume.Slug)
+				if err != nil {
+					return collection, err
+				}
+				for _, part := range parts {
+					books = append(books, b.mapPart(series, volume, part))
+				}
+			}
+			log.Info().Dur("elapsed", time.Since(now)).Msg("Retrieved series data")
+			if !opts.Window.IsZero() {
+				// the API doesn't support filtering, so do it after fetching
+				from, to := opts.Window.Range(now, Period{Years: 1})
+				books = slices.DeleteFunc(books, func(book model.Book) bool {
+					return book.ReleaseDate.Before(from) || book.ReleaseDate.After(to)
+				})
+			}
+			return b.newCollection(
+				series.Title,
+				fmt.Sprintf("series/%s", series.Slug),
+				books,
+			), nil
+		},
+	)
+	key := fmt.Sprintf("jnovelclub/series/%s%s", slug, opts.CacheKey())
+	b.caches.TrackCollection(key, loader)
+	collection, stale, err := b.caches.GetCollection(ctx, key, loader)
+	if err != nil {
+		return Feed{}, err
+	}
+	if !collection.Found {
+		return Feed{}, fmt.Errorf("series not found")
+	}
+	title := fmt.Sprintf("J-Novel Club Series Releases: %s", collection.Name)
+	result, err := b.buildFeed(
+		ctx,
+		fmt.Sprintf("jnovelclub/series/%s", slug),
+		title,
+		b.buildUrl(collection.Slug),
+		"",
+		collection.Created,
+		opts,
+		collection.Books,
+	)
+	if stale {
+		b.markStale(&result, collection.Created)
+	}
+	return result, err
+}
+
+// NewJNovelClubBuilder creates a builder that loads releases with the client,
+// keeping them in caches. now is the clock release windows are based on
+func NewJNovelClubBuilder(
+	client *jnovelclub.Client,
+	caches *cache.Caches,
+	now func() time.Time,
+) Builder {
+	return &jnovelclubBuilder{
+		client: client,
+		builder: builder{
+			provider: pages.JnovelClubProvider,
+			caches:   caches,
+			now:      now,
+		},
+	}
+}
@@ -0,0 +1,202 @@
+package feed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/jnovelclub"
+	"github.com/gorilla/feeds"
+)
+
+// jncFixtures maps J-Novel Club API paths to the responses recorded for the
+// client's tests
+var jncFixtures = map[string]string{
+	"/series/ascendance-of-a-bookworm":                           "series.json",
+	"/series/ascendance-of-a-bookworm/volumes":                   "series_volumes.json",
+	"/volumes/ascendance-of-a-bookworm-part-5-volume-12/parts":   "volume_parts_12.json",
+	"/volumes/ascendance-of-a-bookworm-hannelore-volume-1/parts": "volume_parts_13.json",
+	"/events": "events.json",
+}
+
+var jncNow = time.Date(2025, 11, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestJNovelClubBuilder(t *testing.T) Builder {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := jncFixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, "../jnovelclub/testdata/"+fixture)
+	}))
+	t.Cleanup(server.Close)
+	return NewJNovelClubBuilder(
+		jnovelclub.NewClient(server.URL, server.Client()),
+		cache.NewCaches(nil),
+		func() time.Time { return jncNow },
+	)
+}
+
+func itemTitles(items []*feeds.Item) []string {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	return titles
+}
+
+func TestJNovelClubSeriesReleases(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "released",
+			want: []string{
+				"Ascendance of a Bookworm: Hannelore's Fifth Year at the Royal Academy Volume 1 Part 2",
+				"Ascendance of a Bookworm: Hannelore's Fifth Year at the Royal Academy Volume 1 Part 1",
+				"Ascendance of a Bookworm: Part 5 Volume 12",
+				"Ascendance of a Bookworm: Part 5 Volume 12 Part 2",
+				"Ascendance of a Bookworm: Part 5 Volume 12 Part 1",
+				"Ascendance of a Bookworm: Part 5 Volume 11",
+			},
+		},
+		{
+			name: "window",
+			opts: Options{Window: Window{Since: "2025-10-01"}},
+			want: []string{
+				"Ascendance of a Bookworm: Hannelore's Fifth Year at the Royal Academy Volume 1 Part 2",
+				"Ascendance of a Bookworm: Hannelore's Fifth Year at the Royal Academy Volume 1 Part 1",
+			},
+		},
+		{
+			name: "upcoming",
+			opts: Options{Upcoming: true, Window: Window{Since: "P0D", Until: "P2Y"}},
+			want: []string{
+				"Upcoming: Ascendance of a Bookworm: Hannelore's Fifth Year at the Royal Academy Volume 1",
+				"Upcoming: Ascendance of a Bookworm: Hannelore's Fifth Year at the Royal Academy Volume 1 Part 3",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := newTestJNovelClubBuilder(t)
+			result, err := builder.GetSeriesReleases(
+				context.Background(),
+				"ascendance-of-a-bookworm",
+				test.opts,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Title != "J-Novel Club Series Releases: Ascendance of a Bookworm" {
+				t.Errorf("unexpected title %q", result.Title)
+			}
+			if result.Stale {
+				t.Error("expected a fresh feed")
+			}
+			titles := itemTitles(result.Items)
+			if test.opts.Upcoming {
+				// upcoming items are all dated when they were announced
+				slices.Sort(titles)
+			}
+			if !slices.Equal(titles, test.want) {
+				t.Errorf("expected items %q, got %q", test.want, titles)
+			}
+		})
+	}
+}
+
+func TestJNovelClubSeriesItems(t *testing.T) {
+	builder := newTestJNovelClubBuilder(t)
+	result, err := builder.GetSeriesReleases(
+		context.Background(),
+		"ascendance-of-a-bookworm",
+		Options{Window: Window{Since: "2025-05-01", Until: "2025-06-01"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Items) != 1 {
+		t.Fatalf("expected 1 item, got %q", itemTitles(result.Items))
+	}
+	item := result.Items[0]
+	link := "https://j-novel.club/series/ascendance-of-a-bookworm#volume-12"
+	if item.Link.Href != link {
+		t.Errorf("expected link %s, got %s", link, item.Link.Href)
+	}
+	if item.Author.Name != "Miya Kazuki" {
+		t.Errorf("expected the author, not other creators, got %s", item.Author.Name)
+	}
+	if want := time.Date(2025, 5, 15, 15, 0, 0, 0, time.UTC); !item.Created.Equal(want) {
+		t.Errorf("expected item dated %s, got %s", want, item.Created)
+	}
+	entry, ok := result.Entries[item.Id]
+	if !ok {
+		t.Fatalf("no entry for item %s", item.Id)
+	}
+	if entry.Book.Series.Position != 12 || entry.Book.Series.Title != "Ascendance of a Bookworm" {
+		t.Errorf("unexpected series %+v", entry.Book.Series)
+	}
+	if !slices.Equal(entry.Book.Genres, []string{"Fantasy", "Isekai", "Slice of Life"}) {
+		t.Errorf("expected the series tags, got %q", entry.Book.Genres)
+	}
+}
+
+func TestJNovelClubSeriesNotFound(t *testing.T) {
+	builder := newTestJNovelClubBuilder(t)
+	_, err := builder.GetSeriesReleases(context.Background(), "unknown", Options{})
+	if err == nil || err.Error() != "series not found" {
+		t.Errorf("expected series not found, got %v", err)
+	}
+}
+
+func TestJNovelClubRecentReleases(t *testing.T) {
+	builder := newTestJNovelClubBuilder(t)
+	result, err := builder.GetRecentReleases(context.Background(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"The Faraway Paladin Volume 9",
+		"Ascendance of a Bookworm: Hannelore's Fifth Year at the Royal Academy Volume 1 Part 2",
+	}
+	if titles := itemTitles(result.Items); !slices.Equal(titles, want) {
+		t.Errorf("expected items %q, got %q", want, titles)
+	}
+	link := "https://j-novel.club/series/the-faraway-paladin#volume-9"
+	if result.Items[0].Link.Href != link {
+		t.Errorf("expected link %s, got %s", link, result.Items[0].Link.Href)
+	}
+}
+
+func TestJNovelClubCacheKeys(t *testing.T) {
+	builder := newTestJNovelClubBuilder(t).(*jnovelclubBuilder)
+	ctx := context.Background()
+	opts := Options{Edition: EDITION_EBOOK}
+	if _, err := builder.GetSeriesReleases(ctx, "ascendance-of-a-bookworm", opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := builder.GetRecentReleases(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+	// feeds with other options don't share a cached collection
+	for _, key := range []string{
+		"jnovelclub/series/ascendance-of-a-bookworm",
+		"jnovelclub/releases",
+	} {
+		if _, ok := builder.caches.Collections.GetIfPresent(key); ok {
+			t.Errorf("expected %s not to be cached", key)
+		}
+		if _, ok := builder.caches.Collections.GetIfPresent(key + opts.CacheKey()); !ok {
+			t.Errorf("expected %s to be cached", key+opts.CacheKey())
+		}
+	}
+}
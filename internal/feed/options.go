@@ -0,0 +1,104 @@
+package feed
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+type EditionFormat string
+
+const (
+	EDITION_AUDIO    EditionFormat = "audio"
+	EDITION_EBOOK    EditionFormat = "ebook"
+	EDITION_PHYSICAL EditionFormat = "physical"
+)
+
+var editionFormats = []EditionFormat{EDITION_AUDIO, EDITION_EBOOK, EDITION_PHYSICAL}
+
+// Options customise the contents of a feed
+type Options struct {
+	Window Window
+	// Upcoming lists books before they're released, as soon as they're announced
+	Upcoming bool
+	// Reminder adds a second item for upcoming books on their release day
+	Reminder bool
+	// Edition switches to the release dates of editions in a specific format
+	Edition EditionFormat
+	// Calendar dates a single item for each book on its release date, for
+	// calendar formats
+	Calendar bool
+}
+
+// ParseOptions extracts the options shared by all feeds from a query string
+func ParseOptions(query url.Values) (Options, error) {
+	window, err := ParseWindow(query.Get("since"), query.Get("until"), query.Get("window"))
+	if err != nil {
+		return Options{}, err
+	}
+	edition := EditionFormat(query.Get("format"))
+	if edition != "" && !slices.Contains(editionFormats, edition) {
+		return Options{}, fmt.Errorf("invalid format %q, expected audio, ebook or physical", edition)
+	}
+	opts := Options{
+		Window:   window,
+		Upcoming: parseBool(query.Get("upcoming")),
+		Reminder: parseBool(query.Get("reminder")),
+		Edition:  edition,
+	}
+	if opts.Upcoming {
+		if opts.Window.Since == "" {
+			// reminders need books released recently to stay in the feed
+			opts.Window.Since = "P0D"
+			if opts.Reminder {
+				opts.Window.Since = "P1M"
+			}
+		}
+		if opts.Window.Until == "" {
+			opts.Window.Until = "P2Y"
+		}
+	}
+	return opts, nil
+}
+
+func parseBool(value string) bool {
+	result, _ := strconv.ParseBool(value)
+	return result
+}
+
+// CacheKey is appended to cache keys, so feeds with options that change the
+// data fetched are cached separately. The default options have an empty key
+func (o Options) CacheKey() string {
+	return encodeKey(o.values(url.Values{}))
+}
+
+// Key identifies feeds with different options, e.g. in the feed history
+func (o Options) Key() string {
+	query := o.values(url.Values{})
+	if o.Upcoming {
+		query.Set("upcoming", "true")
+	}
+	if o.Reminder {
+		query.Set("reminder", "true")
+	}
+	if o.Calendar {
+		query.Set("calendar", "true")
+	}
+	return encodeKey(query)
+}
+
+func (o Options) values(query url.Values) url.Values {
+	query = o.Window.values(query)
+	if o.Edition != "" {
+		query.Set("format", string(o.Edition))
+	}
+	return query
+}
+
+func encodeKey(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
@@ -0,0 +1,62 @@
+package feed
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/view"
+	"github.com/a-h/templ"
+)
+
+type Kind string
+
+const (
+	KIND_RECENT    Kind = "recent"
+	KIND_AUTHOR    Kind = "author"
+	KIND_SERIES    Kind = "series"
+	KIND_USER      Kind = "user"
+	KIND_LIST      Kind = "list"
+	KIND_PUBLISHER Kind = "publisher"
+	KIND_GENRE     Kind = "genre"
+	KIND_MIX       Kind = "mix"
+)
+
+// Provider describes a source of feeds, mounted by the server under /{Prefix}
+type Provider struct {
+	Prefix string
+	Data   view.ProviderData
+	Page   templ.Component
+	// ImportPage is served at /{Prefix}/import, for creating feeds from files
+	// exported by other services
+	ImportPage templ.Component
+	Kinds      []Kind
+	// NewBuilder is called once when the server starts, so config is available
+	NewBuilder func(Deps) Builder
+}
+
+// Deps are what the server shares with the builders it creates
+type Deps struct {
+	Caches *cache.Caches
+	// Now is the clock release windows and feed history are based on
+	Now func() time.Time
+}
+
+var (
+	providers   []Provider
+	providersMu sync.RWMutex
+)
+
+// Register adds a provider to the registry, typically from an init() function
+func Register(provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers = append(providers, provider)
+}
+
+// Providers returns all registered providers, in the order they were registered
+func Providers() []Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	return append([]Provider(nil), providers...)
+}
@@ -0,0 +1,154 @@
+package feed
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var periodRegex = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?$`)
+
+// Period is an ISO 8601 duration limited to calendar units, e.g. P6M or P1Y2W
+type Period struct {
+	Years  int
+	Months int
+	Days   int
+}
+
+func ParsePeriod(value string) (Period, error) {
+	matches := periodRegex.FindStringSubmatch(strings.ToUpper(value))
+	if matches == nil || value == "P" {
+		return Period{}, fmt.Errorf("invalid period %q, expected e.g. P6M", value)
+	}
+	values := make([]int, len(matches)-1)
+	for i, match := range matches[1:] {
+		if match != "" {
+			values[i], _ = strconv.Atoi(match)
+		}
+	}
+	return Period{
+		Years:  values[0],
+		Months: values[1],
+		Days:   values[2]*7 + values[3],
+	}, nil
+}
+
+func (p Period) String() string {
+	if p == (Period{}) {
+		return "P0D"
+	}
+	var sb strings.Builder
+	sb.WriteString("P")
+	for _, unit := range []struct {
+		value  int
+		suffix string
+	}{{p.Years, "Y"}, {p.Months, "M"}, {p.Days, "D"}} {
+		if unit.value != 0 {
+			fmt.Fprintf(&sb, "%d%s", unit.value, unit.suffix)
+		}
+	}
+	return sb.String()
+}
+
+// Before returns the time the period before t
+func (p Period) Before(t time.Time) time.Time {
+	return t.AddDate(-p.Years, -p.Months, -p.Days)
+}
+
+// After returns the time the period after t
+func (p Period) After(t time.Time) time.Time {
+	return t.AddDate(p.Years, p.Months, p.Days)
+}
+
+// Window is the range of release dates included in a feed. Each bound is either
+// empty (use the feed's default), a fixed date, or a period relative to now
+type Window struct {
+	Since string
+	Until string
+}
+
+// ParseWindow validates and normalises the since/until bounds. window is
+// shorthand for since, as a period e.g. P6M
+func ParseWindow(since, until, window string) (Window, error) {
+	if window != "" {
+		if since != "" {
+			return Window{}, fmt.Errorf("window and since can't both be provided")
+		}
+		if _, err := ParsePeriod(window); err != nil {
+			return Window{}, err
+		}
+		since = window
+	}
+	var err error
+	var result Window
+	if result.Since, err = normaliseBound(since); err != nil {
+		return Window{}, fmt.Errorf("invalid since: %w", err)
+	}
+	if result.Until, err = normaliseBound(until); err != nil {
+		return Window{}, fmt.Errorf("invalid until: %w", err)
+	}
+	return result, nil
+}
+
+func normaliseBound(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(strings.ToUpper(value), "P") {
+		period, err := ParsePeriod(value)
+		if err != nil {
+			return "", err
+		}
+		return period.String(), nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return "", fmt.Errorf("expected a date (YYYY-MM-DD) or period (e.g. P6M)")
+	}
+	return date.Format(time.DateOnly), nil
+}
+
+func (w Window) IsZero() bool {
+	return w.Since == "" && w.Until == ""
+}
+
+// Key is appended to cache keys, so feeds with different windows are cached
+// separately. The default window has an empty key
+func (w Window) Key() string {
+	return encodeKey(w.values(url.Values{}))
+}
+
+func (w Window) values(query url.Values) url.Values {
+	if w.Since != "" {
+		query.Set("since", w.Since)
+	}
+	if w.Until != "" {
+		query.Set("until", w.Until)
+	}
+	return query
+}
+
+// Range resolves the window relative to now. Without a since bound, the window
+// starts lookback before now, and without an until bound it ends now
+func (w Window) Range(now time.Time, lookback Period) (from, to time.Time) {
+	from = lookback.Before(now)
+	to = now
+	if w.Since != "" {
+		if period, err := ParsePeriod(w.Since); err == nil {
+			from = period.Before(now)
+		} else if date, err := time.Parse(time.DateOnly, w.Since); err == nil {
+			from = date
+		}
+	}
+	if w.Until != "" {
+		if period, err := ParsePeriod(w.Until); err == nil {
+			to = period.After(now)
+		} else if date, err := time.Parse(time.DateOnly, w.Until); err == nil {
+			to = date
+		}
+	}
+	return from, to
+}
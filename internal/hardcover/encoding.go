@@ -28,3 +28,29 @@ func MarshalHardcoverDate(v *time.Time) ([]byte, error) {
 	formattedTime := v.Format(time.DateOnly)
 	return json.Marshal(formattedTime)
 }
+
+// timestamp columns are returned without a timezone, and are stored as UTC
+const hardcoverTimestamp = "2006-01-02T15:04:05.999999"
+
+func UnmarshalHardcoverTimestamp(b []byte, v *time.Time) error {
+	var input string
+	err := json.Unmarshal(b, &input)
+	if err != nil {
+		return err
+	}
+	parsedTime, err := time.Parse(hardcoverTimestamp, input)
+	if err != nil {
+		return err
+	}
+	*v = parsedTime
+	return nil
+}
+
+func MarshalHardcoverTimestamp(v *time.Time) ([]byte, error) {
+	if v == nil {
+		return nil, errors.New("nil time value")
+	}
+
+	formattedTime := v.UTC().Format(hardcoverTimestamp)
+	return json.Marshal(formattedTime)
+}
@@ -0,0 +1,120 @@
+// Package hardcovertest provides a fake Hardcover API for tests, answering
+// queries with canned responses rather than making requests
+package hardcovertest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/Khan/genqlient/graphql"
+)
+
+// Response returns the JSON data for a query, given its variables
+type Response func(variables map[string]any) (string, error)
+
+// Respond always answers with the same data
+func Respond(data string) Response {
+	return func(map[string]any) (string, error) {
+		return data, nil
+	}
+}
+
+// Matching answers with the entries of data[field] whose slug is in the
+// query's slug variable, or whose id is in its ids variable, like the queries
+// for authors and series do. Entries need an id to be matched by id, even if
+// the query doesn't select it
+func Matching(data []byte, field string) Response {
+	return func(variables map[string]any) (string, error) {
+		var all map[string][]map[string]any
+		if err := json.Unmarshal(data, &all); err != nil {
+			return "", err
+		}
+		slugs, _ := variables["slug"].([]any)
+		ids, _ := variables["ids"].([]any)
+		matched := []map[string]any{}
+		for _, entry := range all[field] {
+			if slices.Contains(slugs, entry["slug"]) || slices.Contains(ids, entry["id"]) {
+				matched = append(matched, entry)
+			}
+		}
+		encoded, err := json.Marshal(map[string]any{field: matched})
+		return string(encoded), err
+	}
+}
+
+// Request is a query made to the client
+type Request struct {
+	Op        string
+	Variables map[string]any
+}
+
+// Client is a graphql.Client answering each operation with the response
+// registered for it, and recording the requests made
+type Client struct {
+	mu        sync.Mutex
+	responses map[string]Response
+	requests  []Request
+	err       error
+}
+
+// NewClient creates a client with a response for each operation name.
+// Operations without one fail
+func NewClient(responses map[string]Response) *Client {
+	return &Client{responses: responses}
+}
+
+// Fail makes every request fail with err, as if Hardcover couldn't be
+// reached, until it's called again with nil
+func (c *Client) Fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// Requests returns the variables of each request made for an operation
+func (c *Client) Requests(op string) []map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var variables []map[string]any
+	for _, request := range c.requests {
+		if request.Op == op {
+			variables = append(variables, request.Variables)
+		}
+	}
+	return variables
+}
+
+func (c *Client) MakeRequest(
+	ctx context.Context,
+	req *graphql.Request,
+	resp *graphql.Response,
+) error {
+	// round trip the variables, so responses see them as the API would
+	encoded, err := json.Marshal(req.Variables)
+	if err != nil {
+		return err
+	}
+	var variables map[string]any
+	if err := json.Unmarshal(encoded, &variables); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, Request{Op: req.OpName, Variables: variables})
+	respond, ok := c.responses[req.OpName]
+	failure := c.err
+	c.mu.Unlock()
+	if failure != nil {
+		return failure
+	}
+	if !ok {
+		return fmt.Errorf("hardcovertest: no response for %s", req.OpName)
+	}
+	data, err := respond(variables)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), resp.Data)
+}
@@ -0,0 +1,55 @@
+package httpclient
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+type headerTransport struct {
+	headers map[string]string
+	wrapped http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	version := getVersion()
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set(
+		"User-Agent",
+		fmt.Sprintf("bookfeed/%s (https://github.com/RobBrazier/bookfeed)", version),
+	)
+	return t.wrapped.RoundTrip(req)
+}
+
+func getVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				if len(setting.Value) >= 7 {
+					return setting.Value[:7]
+				}
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// NewClient returns a http.Client that retries failed requests, identifies itself
+// with the bookfeed User-Agent and sets the provided headers on every request
+func NewClient(headers map[string]string) *http.Client {
+	retryClient := retryablehttp.NewClient()
+	retryClient.HTTPClient = &http.Client{
+		Transport: &headerTransport{
+			headers: headers,
+			wrapped: http.DefaultTransport,
+		},
+	}
+	retryClient.Logger = slog.Default()
+	return retryClient.StandardClient()
+}
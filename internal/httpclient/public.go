@@ -0,0 +1,126 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+var ErrPrivateAddress = errors.New("address is not public")
+
+// reservedPrefixes aren't covered by the checks in netip, but aren't public
+var reservedPrefixes = []netip.Prefix{
+	// "this network", which reaches the host itself
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// shared address space, used by carrier-grade NAT
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// IsPublic reports whether an address is reachable on the internet, rather
+// than being on the host (loopback), the local network (private or
+// link-local, which includes cloud metadata services) or otherwise reserved
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckPublicHost resolves host, returning ErrPrivateAddress if any of its
+// addresses aren't public
+func CheckPublicHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !IsPublic(addr) {
+			return fmt.Errorf("%s: %w", host, ErrPrivateAddress)
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr) {
+			return fmt.Errorf("%s resolves to %s: %w", host, addr, ErrPrivateAddress)
+		}
+	}
+	return nil
+}
+
+// publicOnly refuses connections to addresses that aren't public. It's
+// checked as each connection is made, after the host is resolved, so the
+// answer can't change between checking the address and using it
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublic(addrPort.Addr()) {
+		return fmt.Errorf("%s: %w", address, ErrPrivateAddress)
+	}
+	return nil
+}
+
+func noRedirects(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// NewPublicClient is like NewClient, for requests to urls supplied by users.
+// It only connects to public addresses, and returns redirects rather than
+// following them, so it can't be pointed at services on the local network
+func NewPublicClient(headers map[string]string) *http.Client {
+	return newPublicClient(headers, publicOnly)
+}
+
+// newPublicClient checks each connection with control
+func newPublicClient(
+	headers map[string]string,
+	control func(network, address string, c syscall.RawConn) error,
+) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// connecting through a proxy would hide the address being requested
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}).DialContext
+
+	retryClient := retryablehttp.NewClient()
+	retryClient.HTTPClient = &http.Client{
+		Transport: &headerTransport{
+			headers: headers,
+			wrapped: transport,
+		},
+		CheckRedirect: noRedirects,
+	}
+	retryClient.CheckRetry = func(
+		ctx context.Context,
+		resp *http.Response,
+		err error,
+	) (bool, error) {
+		// refused addresses won't be allowed on a retry either
+		if errors.Is(err, ErrPrivateAddress) {
+			return false, err
+		}
+		return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	}
+	retryClient.Logger = slog.Default()
+	client := retryClient.StandardClient()
+	client.CheckRedirect = noRedirects
+	return client
+}
@@ -0,0 +1,110 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{addr: "8.8.8.8", public: true},
+		{addr: "2606:4700:4700::1111", public: true},
+		{addr: "127.0.0.1"},
+		{addr: "::1"},
+		{addr: "10.1.2.3"},
+		{addr: "172.16.0.1"},
+		{addr: "192.168.1.1"},
+		{addr: "fd00::1"},
+		{addr: "169.254.169.254"},
+		{addr: "fe80::1"},
+		{addr: "0.0.0.0"},
+		{addr: "0.1.2.3"},
+		{addr: "::"},
+		{addr: "100.64.0.1"},
+		{addr: "224.0.0.1"},
+		{addr: "255.255.255.255"},
+		{addr: "::ffff:127.0.0.1"},
+		{addr: "::ffff:169.254.169.254"},
+	}
+	for _, test := range tests {
+		t.Run(test.addr, func(t *testing.T) {
+			if public := IsPublic(netip.MustParseAddr(test.addr)); public != test.public {
+				t.Errorf("expected public to be %t, got %t", test.public, public)
+			}
+		})
+	}
+}
+
+func TestCheckPublicHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		private bool
+	}{
+		{host: "1.1.1.1"},
+		{host: "169.254.169.254", private: true},
+		{host: "::1", private: true},
+		{host: "localhost", private: true},
+	}
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			err := CheckPublicHost(context.Background(), test.host)
+			if errors.Is(err, ErrPrivateAddress) != test.private {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestPublicClientRefusesPrivateAddresses(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	resp, err := NewPublicClient(nil).Post(server.URL, "application/json", nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("expected the private address to be refused, got %v", err)
+	}
+	if count := requests.Load(); count != 0 {
+		t.Errorf("expected no requests to reach the server, got %d", count)
+	}
+}
+
+func TestPublicClientReturnsRedirects(t *testing.T) {
+	var followed atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/internal", http.StatusFound)
+	})
+	mux.HandleFunc("/internal", func(w http.ResponseWriter, r *http.Request) {
+		followed.Store(true)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// allow the test server's address, to check redirects on their own
+	client := newPublicClient(nil, nil)
+	resp, err := client.Post(server.URL+"/hook", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("expected the redirect to be returned, got %s", resp.Status)
+	}
+	if followed.Load() {
+		t.Error("expected the redirect not to be followed")
+	}
+}
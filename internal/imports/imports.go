@@ -0,0 +1,214 @@
+// Package imports extracts the authors and series from files exported by
+// other services, such as OPML subscription lists and Goodreads or StoryGraph
+// library exports
+package imports
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Candidate is an author or series found in an import
+type Candidate struct {
+	Name string
+	// Slug is set when the import already refers to a feed, e.g. an OPML
+	// export of bookfeed feeds, so the name doesn't need resolving
+	Slug string
+	// Count is how many books or feeds referred to the candidate
+	Count int
+}
+
+// Result is everything found in an import, with the most referenced
+// candidates first
+type Result struct {
+	Authors []Candidate
+	Series  []Candidate
+}
+
+var ErrUnrecognised = errors.New("file isn't an OPML or CSV export")
+
+// Parse reads an OPML or CSV file, depending on its content
+func Parse(r io.Reader) (Result, error) {
+	reader := bufio.NewReader(r)
+	bom := []byte("\ufeff")
+	if start, _ := reader.Peek(len(bom)); bytes.Equal(start, bom) {
+		_, _ = reader.Discard(len(bom))
+	}
+	start, _ := reader.Peek(512)
+	start = bytes.TrimLeft(start, " \t\r\n")
+	if bytes.HasPrefix(start, []byte("<")) {
+		return ParseOpml(reader)
+	}
+	return ParseCsv(reader)
+}
+
+// counter tallies candidates, keeping the first spelling of each name
+type counter struct {
+	candidates map[string]*Candidate
+}
+
+func (c *counter) add(name, slug string) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" && slug == "" {
+		return
+	}
+	key := strings.ToLower(name)
+	if slug != "" {
+		key = "/" + slug
+	}
+	if c.candidates == nil {
+		c.candidates = make(map[string]*Candidate)
+	}
+	candidate, ok := c.candidates[key]
+	if !ok {
+		candidate = &Candidate{Name: name, Slug: slug}
+		c.candidates[key] = candidate
+	}
+	candidate.Count++
+}
+
+func (c *counter) sorted() []Candidate {
+	var result []Candidate
+	for _, candidate := range c.candidates {
+		result = append(result, *candidate)
+	}
+	slices.SortFunc(result, func(a, b Candidate) int {
+		return cmp.Or(
+			cmp.Compare(b.Count, a.Count),
+			strings.Compare(a.Name, b.Name),
+			strings.Compare(a.Slug, b.Slug),
+		)
+	})
+	return result
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	XmlUrl   string        `xml:"xmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlDocument struct {
+	XMLName xml.Name      `xml:"opml"`
+	Body    []opmlOutline `xml:"body>outline"`
+}
+
+// feedPathPattern matches the author and series feeds of any provider, so a
+// bookfeed export can be imported without searching
+var feedPathPattern = regexp.MustCompile(`/(author|series)/([a-z0-9-]+)\.[a-z]+$`)
+
+// ParseOpml reads the feeds in an OPML file. Links to author and series
+// feeds are used as they are, and any other feeds are taken to be named after
+// an author, or a series if they're in a folder named like one
+func ParseOpml(r io.Reader) (Result, error) {
+	var document opmlDocument
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return Result{}, fmt.Errorf("%w: %w", ErrUnrecognised, err)
+	}
+	var authors, series counter
+	var walk func(outlines []opmlOutline, inSeries bool)
+	walk = func(outlines []opmlOutline, inSeries bool) {
+		for _, outline := range outlines {
+			name := cmp.Or(outline.Title, outline.Text)
+			if len(outline.Outlines) > 0 {
+				folder := strings.Contains(strings.ToLower(name), "series")
+				walk(outline.Outlines, inSeries || folder)
+				continue
+			}
+			if link, err := url.Parse(outline.XmlUrl); err == nil {
+				match := feedPathPattern.FindStringSubmatch(link.Path)
+				if match != nil && match[1] == "series" {
+					series.add(name, match[2])
+					continue
+				}
+				if match != nil {
+					authors.add(name, match[2])
+					continue
+				}
+			}
+			if inSeries {
+				series.add(name, "")
+			} else {
+				authors.add(name, "")
+			}
+		}
+	}
+	walk(document.Body, false)
+	return Result{Authors: authors.sorted(), Series: series.sorted()}, nil
+}
+
+// seriesPattern matches the series Goodreads appends to titles, e.g.
+// "The Way of Kings (The Stormlight Archive, #1)"
+var seriesPattern = regexp.MustCompile(`\(([^()#]+?),?\s*#[\d.]+(?:-[\d.]+)?\)\s*$`)
+
+// ParseCsv reads a Goodreads or StoryGraph library export, counting the books
+// by each author and in each series
+func ParseCsv(r io.Reader) (Result, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %w", ErrUnrecognised, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	// Goodreads has a single author, while StoryGraph lists them all
+	_, single := columns["author"]
+	_, multiple := columns["authors"]
+	if !single && !multiple {
+		return Result{}, fmt.Errorf("%w: no author column", ErrUnrecognised)
+	}
+
+	var authors, series counter
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Result{}, fmt.Errorf("%w: %w", ErrUnrecognised, err)
+		}
+		if single {
+			authors.add(field(record, "author"), "")
+		} else {
+			for name := range strings.SplitSeq(field(record, "authors"), ",") {
+				authors.add(name, "")
+			}
+		}
+		if name := field(record, "series"); name != "" {
+			series.add(seriesName(name), "")
+		} else if match := seriesPattern.FindStringSubmatch(field(record, "title")); match != nil {
+			series.add(match[1], "")
+		}
+	}
+	return Result{Authors: authors.sorted(), Series: series.sorted()}, nil
+}
+
+// seriesName strips the position from a series column, e.g. "Discworld #3"
+func seriesName(name string) string {
+	if i := strings.LastIndex(name, "#"); i > 0 {
+		name = strings.TrimRight(name[:i], " ,")
+	}
+	return name
+}
@@ -0,0 +1,217 @@
+package imports
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOpml(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Result
+		invalid bool
+	}{
+		{
+			name: "bookfeed export",
+			input: `<?xml version="1.0"?>
+<opml version="2.0"><body>
+	<outline text="Brandon Sanderson"
+		xmlUrl="https://bookfeed.example.com/hc/author/brandon-sanderson.atom"/>
+	<outline title="The Stormlight Archive" text="ignored"
+		xmlUrl="https://bookfeed.example.com/hc/series/the-stormlight-archive.rss?since=P1Y"/>
+</body></opml>`,
+			want: Result{
+				Authors: []Candidate{
+					{Name: "Brandon Sanderson", Slug: "brandon-sanderson", Count: 1},
+				},
+				Series: []Candidate{
+					{Name: "The Stormlight Archive", Slug: "the-stormlight-archive", Count: 1},
+				},
+			},
+		},
+		{
+			name: "nested outlines",
+			input: `<opml><body>
+	<outline text="Books">
+		<outline text="Robin Hobb" xmlUrl="https://example.com/robin-hobb.xml"/>
+		<outline text="My Series">
+			<outline text="Discworld" xmlUrl="https://example.com/discworld.xml"/>
+			<outline text="Nested">
+				<outline text="The Expanse"/>
+			</outline>
+		</outline>
+	</outline>
+	<outline text="robin  hobb"/>
+</body></opml>`,
+			want: Result{
+				Authors: []Candidate{{Name: "Robin Hobb", Count: 2}},
+				Series: []Candidate{
+					{Name: "Discworld", Count: 1},
+					{Name: "The Expanse", Count: 1},
+				},
+			},
+		},
+		{
+			name:  "empty outlines",
+			input: `<opml><body><outline text=""/><outline text="  "/></body></opml>`,
+			want:  Result{},
+		},
+		{
+			name:    "unclosed tags",
+			input:   `<opml><body><outline text="Robin Hobb">`,
+			invalid: true,
+		},
+		{
+			name:    "not opml",
+			input:   `<rss><channel></channel></rss>`,
+			invalid: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseOpml(strings.NewReader(test.input))
+			if test.invalid {
+				if !errors.Is(err, ErrUnrecognised) {
+					t.Errorf("expected ErrUnrecognised, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCsv(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Result
+		invalid bool
+	}{
+		{
+			name: "goodreads",
+			input: "Book Id,Title,Author,Author l-f\n" +
+				"1,\"The Way of Kings (The Stormlight Archive, #1)\"," +
+				"Brandon Sanderson,\"Sanderson, Brandon\"\n" +
+				"2,\"Words of Radiance (The Stormlight Archive, #2)\"," +
+				"Brandon Sanderson,\"Sanderson, Brandon\"\n" +
+				"3,\"Assassin's Apprentice (Farseer Trilogy #1-2)\",Robin Hobb,\"Hobb, Robin\"\n",
+			want: Result{
+				Authors: []Candidate{
+					{Name: "Brandon Sanderson", Count: 2},
+					{Name: "Robin Hobb", Count: 1},
+				},
+				Series: []Candidate{
+					{Name: "The Stormlight Archive", Count: 2},
+					{Name: "Farseer Trilogy", Count: 1},
+				},
+			},
+		},
+		{
+			name: "storygraph",
+			input: "Title,Authors,Series\n" +
+				"Good Omens,\"Terry Pratchett, Neil Gaiman\",\n" +
+				"Equal Rites,Terry Pratchett,\"Discworld #3\"\n",
+			want: Result{
+				Authors: []Candidate{
+					{Name: "Terry Pratchett", Count: 2},
+					{Name: "Neil Gaiman", Count: 1},
+				},
+				Series: []Candidate{{Name: "Discworld", Count: 1}},
+			},
+		},
+		{
+			name:  "header variants",
+			input: " TITLE , AUTHOR \nMistborn,Brandon Sanderson\n",
+			want:  Result{Authors: []Candidate{{Name: "Brandon Sanderson", Count: 1}}},
+		},
+		{
+			name:  "byte order mark",
+			input: "\ufeffAuthor,Title\nRobin Hobb,Fool's Errand\n",
+			want:  Result{Authors: []Candidate{{Name: "Robin Hobb", Count: 1}}},
+		},
+		{
+			name: "quoting",
+			input: "Title,Author\n" +
+				"\"The \"\"Quoted\"\" Book\",\"Le Guin, Ursula\"\n" +
+				"\"Multi\nline\",\"Ursula K. Le Guin\"\n",
+			want: Result{
+				Authors: []Candidate{
+					{Name: "Le Guin, Ursula", Count: 1},
+					{Name: "Ursula K. Le Guin", Count: 1},
+				},
+			},
+		},
+		{
+			name:  "empty rows",
+			input: "Title,Author\n\n,\n\nElantris,Brandon Sanderson\n,,\n",
+			want:  Result{Authors: []Candidate{{Name: "Brandon Sanderson", Count: 1}}},
+		},
+		{
+			name:    "no author column",
+			input:   "Title,Rating\nElantris,5\n",
+			invalid: true,
+		},
+		{
+			name:    "empty file",
+			input:   "",
+			invalid: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseCsv(strings.NewReader(test.input))
+			if test.invalid {
+				if !errors.Is(err, ErrUnrecognised) {
+					t.Errorf("expected ErrUnrecognised, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "opml", input: `<opml><body><outline text="Robin Hobb"/></body></opml>`},
+		{
+			name:  "opml with whitespace",
+			input: "\n\t <opml><body><outline text=\"Robin Hobb\"/></body></opml>",
+		},
+		{
+			name:  "opml with byte order mark",
+			input: "\ufeff<opml><body><outline text=\"Robin Hobb\"/></body></opml>",
+		},
+		{name: "csv", input: "Author\nRobin Hobb\n"},
+		{name: "csv with byte order mark", input: "\ufeffAuthor\nRobin Hobb\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []Candidate{{Name: "Robin Hobb", Count: 1}}
+			if !reflect.DeepEqual(got.Authors, want) {
+				t.Errorf("expected %+v, got %+v", want, got.Authors)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package jnovelclub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/httpclient"
+)
+
+const DefaultURL = "https://labs.j-novel.club/app/v2"
+
+var ErrNotFound = errors.New("not found")
+
+type Client struct {
+	baseUrl    string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the J-Novel Club API at baseUrl (e.g. a fake
+// server serving recorded fixtures)
+func NewClient(baseUrl string, httpClient *http.Client) *Client {
+	return &Client{
+		baseUrl:    baseUrl,
+		httpClient: httpClient,
+	}
+}
+
+func GetClient() *Client {
+	return NewClient(DefaultURL, httpclient.NewClient(nil))
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("format", "json")
+	endpoint := fmt.Sprintf("%s%s?%s", c.baseUrl, path, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("unexpected status from %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) Series(ctx context.Context, slug string) (Series, error) {
+	var series Series
+	err := c.get(ctx, fmt.Sprintf("/series/%s", url.PathEscape(slug)), nil, &series)
+	return series, err
+}
+
+func (c *Client) SeriesVolumes(ctx context.Context, slug string) ([]Volume, error) {
+	var data struct {
+		Volumes []Volume `json:"volumes"`
+	}
+	path := fmt.Sprintf("/series/%s/volumes", url.PathEscape(slug))
+	err := c.get(ctx, path, url.Values{"limit": {"100"}}, &data)
+	return data.Volumes, err
+}
+
+func (c *Client) VolumeParts(ctx context.Context, slug string) ([]Part, error) {
+	var data struct {
+		Parts []Part `json:"parts"`
+	}
+	path := fmt.Sprintf("/volumes/%s/parts", url.PathEscape(slug))
+	err := c.get(ctx, path, url.Values{"limit": {"100"}}, &data)
+	return data.Parts, err
+}
+
+// Events returns the release calendar (volumes and parts) between from and to
+func (c *Client) Events(ctx context.Context, from, to time.Time) ([]Event, error) {
+	var data struct {
+		Events []Event `json:"events"`
+	}
+	query := url.Values{
+		"start_date": {from.UTC().Format(time.RFC3339)},
+		"end_date":   {to.UTC().Format(time.RFC3339)},
+		"limit":      {"100"},
+	}
+	err := c.get(ctx, "/events", query, &data)
+	return data.Events, err
+}
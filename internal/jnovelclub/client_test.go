@@ -0,0 +1,168 @@
+package jnovelclub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fixtures maps API paths to the recorded responses in testdata
+var fixtures = map[string]string{
+	"/series/ascendance-of-a-bookworm":                           "testdata/series.json",
+	"/series/ascendance-of-a-bookworm/volumes":                   "testdata/series_volumes.json",
+	"/volumes/ascendance-of-a-bookworm-part-5-volume-12/parts":   "testdata/volume_parts_12.json",
+	"/volumes/ascendance-of-a-bookworm-hannelore-volume-1/parts": "testdata/volume_parts_13.json",
+	"/events": "testdata/events.json",
+}
+
+// requestLog records the query of the last request to each path
+type requestLog struct {
+	mu     sync.Mutex
+	byPath map[string]string
+}
+
+func (q *requestLog) get(path string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.byPath[path]
+}
+
+// newTestClient serves the fixtures, recording the query of each request
+func newTestClient(t *testing.T) (*Client, *requestLog) {
+	t.Helper()
+	recorded := &requestLog{byPath: make(map[string]string)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorded.mu.Lock()
+		recorded.byPath[r.URL.Path] = r.URL.RawQuery
+		recorded.mu.Unlock()
+		if r.URL.Path == "/series/broken" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fixture, ok := fixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeFile(w, r, fixture)
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, server.Client()), recorded
+}
+
+func TestSeries(t *testing.T) {
+	client, queries := newTestClient(t)
+	series, err := client.Series(context.Background(), "ascendance-of-a-bookworm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if series.Title != "Ascendance of a Bookworm" || series.Slug != "ascendance-of-a-bookworm" {
+		t.Errorf("unexpected series %+v", series)
+	}
+	if len(series.Tags) != 3 {
+		t.Errorf("expected 3 tags, got %v", series.Tags)
+	}
+	cover := "https://cdn.j-novel.club/uploads/bookworm-series-cover.jpg"
+	if series.Cover.CoverUrl != cover {
+		t.Errorf("expected cover %s, got %s", cover, series.Cover.CoverUrl)
+	}
+	if query := queries.get("/series/ascendance-of-a-bookworm"); query != "format=json" {
+		t.Errorf("expected json to be requested, got query %q", query)
+	}
+}
+
+func TestSeriesErrors(t *testing.T) {
+	client, _ := newTestClient(t)
+	tests := []struct {
+		slug     string
+		notFound bool
+	}{
+		{slug: "unknown", notFound: true},
+		{slug: "broken"},
+	}
+	for _, test := range tests {
+		t.Run(test.slug, func(t *testing.T) {
+			_, err := client.Series(context.Background(), test.slug)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if errors.Is(err, ErrNotFound) != test.notFound {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestSeriesVolumes(t *testing.T) {
+	client, queries := newTestClient(t)
+	volumes, err := client.SeriesVolumes(context.Background(), "ascendance-of-a-bookworm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 3 {
+		t.Fatalf("expected 3 volumes, got %d", len(volumes))
+	}
+	volume := volumes[1]
+	if volume.Number != 12 || volume.Slug != "ascendance-of-a-bookworm-part-5-volume-12" {
+		t.Errorf("unexpected volume %+v", volume)
+	}
+	if want := time.Date(2025, 5, 15, 15, 0, 0, 0, time.UTC); !volume.Publishing.Equal(want) {
+		t.Errorf("expected publishing %s, got %s", want, volume.Publishing)
+	}
+	if len(volume.Creators) != 2 || volume.Creators[0].Role != "AUTHOR" {
+		t.Errorf("unexpected creators %+v", volume.Creators)
+	}
+	query := queries.get("/series/ascendance-of-a-bookworm/volumes")
+	if query != "format=json&limit=100" {
+		t.Errorf("unexpected query %q", query)
+	}
+}
+
+func TestVolumeParts(t *testing.T) {
+	client, _ := newTestClient(t)
+	parts, err := client.VolumeParts(
+		context.Background(),
+		"ascendance-of-a-bookworm-hannelore-volume-1",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+	for i, part := range parts {
+		if part.Number != i+1 {
+			t.Errorf("expected part %d, got %d", i+1, part.Number)
+		}
+		if part.Launch.IsZero() {
+			t.Errorf("part %d has no launch date", part.Number)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	client, queries := newTestClient(t)
+	from := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 11, 1, 0, 0, 0, 0, time.FixedZone("BST", 3600))
+	events, err := client.Events(context.Background(), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	if events[1].Name != "The Faraway Paladin" || events[1].Number != "Volume 9" {
+		t.Errorf("unexpected event %+v", events[1])
+	}
+	// dates are sent in UTC
+	want := "end_date=2025-10-31T23%3A00%3A00Z&format=json&limit=100" +
+		"&start_date=2025-10-01T00%3A00%3A00Z"
+	if query := queries.get("/events"); query != want {
+		t.Errorf("expected query %q, got %q", want, query)
+	}
+}
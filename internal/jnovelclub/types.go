@@ -0,0 +1,49 @@
+package jnovelclub
+
+import "time"
+
+type Cover struct {
+	CoverUrl     string `json:"coverUrl"`
+	ThumbnailUrl string `json:"thumbnailUrl"`
+}
+
+type Creator struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type Series struct {
+	Title       string   `json:"title"`
+	Slug        string   `json:"slug"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Cover       Cover    `json:"cover"`
+}
+
+type Volume struct {
+	Title            string    `json:"title"`
+	Slug             string    `json:"slug"`
+	Number           int       `json:"number"`
+	Creators         []Creator `json:"creators"`
+	Publishing       time.Time `json:"publishing"`
+	Description      string    `json:"description"`
+	ShortDescription string    `json:"shortDescription"`
+	Cover            Cover     `json:"cover"`
+}
+
+type Part struct {
+	Title  string    `json:"title"`
+	Slug   string    `json:"slug"`
+	Number int       `json:"number"`
+	Launch time.Time `json:"launch"`
+	Cover  Cover     `json:"cover"`
+}
+
+type Event struct {
+	Name         string    `json:"name"`
+	Number       string    `json:"number"`
+	Details      string    `json:"details"`
+	LinkFragment string    `json:"linkFragment"`
+	Launch       time.Time `json:"launch"`
+	Cover        Cover     `json:"cover"`
+}
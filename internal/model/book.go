@@ -27,12 +27,18 @@ type Book struct {
 	Compilation bool
 	Title       string
 	ReleaseDate time.Time
+	Added       time.Time
+	Announced   time.Time
 	Headline    string
 	Description string
 	Genres      []string
 	Authors     []string
 	Image       Image
 	Series      Series
+	Edition     Edition
+	// NewEditions are editions published after the original release, which
+	// each get their own feed item
+	NewEditions []Edition
 }
 
 type Image struct {
@@ -46,13 +52,41 @@ type Series struct {
 	Position float32
 }
 
+type Edition struct {
+	Id          int
+	ReleaseDate time.Time
+	Format      string
+	Publisher   string
+	Narrators   []string
+	Isbn13      string
+	Asin        string
+	Duration    time.Duration
+}
+
 type Interest struct {
 	Slug string
 	Id   int
+	Name string
 }
 
 type UserInterests struct {
 	Authors []Interest
 	Series  []Interest
+	Books   []Book
 	Found   bool
+	// Created is when the interests were loaded
+	Created time.Time
+}
+
+// Entry is a single item in a feed for a book
+type Entry struct {
+	Id        string
+	Title     string
+	Date      time.Time
+	Upcoming  bool
+	FirstSeen time.Time
+	Book      Book
 }
+
+// History is the entries previously included in a feed, keyed by entry id
+type History map[string]Entry
@@ -0,0 +1,14 @@
+package model
+
+// FeedDefinition describes a feed saved to be served from a short link
+type FeedDefinition struct {
+	Provider string `json:"provider"`
+	Kind     string `json:"kind"`
+	// Slugs fill the path parameters of the feed kind, in order
+	Slugs []string `json:"slugs,omitempty"`
+	// Filters are passed to the feed as query parameters
+	Filters map[string]string `json:"filters,omitempty"`
+	Since   string            `json:"since,omitempty"`
+	Until   string            `json:"until,omitempty"`
+	Format  string            `json:"format,omitempty"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+type DigestFrequency string
+
+const (
+	DIGEST_DAILY  DigestFrequency = "daily"
+	DIGEST_WEEKLY DigestFrequency = "weekly"
+)
+
+// Digest emails new items from a saved feed on a schedule
+type Digest struct {
+	Feed      string
+	Email     string
+	Frequency DigestFrequency
+	// Token authorises confirming and unsubscribing from the digest
+	Token     string
+	Confirmed bool
+	Created   time.Time
+	// Sent is when the last digest was sent, only items first seen after
+	// this are included in the next one
+	Sent time.Time
+}
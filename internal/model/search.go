@@ -0,0 +1,10 @@
+package model
+
+// SearchResult is an author or series matching a search
+type SearchResult struct {
+	Id         int    `json:"-"`
+	Slug       string `json:"slug"`
+	Name       string `json:"name"`
+	Image      string `json:"image,omitempty"`
+	BooksCount int    `json:"books_count"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Webhook receives new items from a saved feed as they're found
+type Webhook struct {
+	Feed    string
+	Url     string
+	Secret  string
+	Created time.Time
+	// Checked is when the feed was last checked for new items. Nothing is
+	// delivered the first time, so subscribers don't receive the whole feed
+	Checked time.Time
+	// Delivered are the ids of items already sent to the webhook
+	Delivered []string
+	// Failures counts the deliveries in a row that have failed
+	Failures int
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/feed"
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+var pathParamPattern = regexp.MustCompile(`\{(\w+):([^}]+)\}`)
+
+// resolvedDefinition is a saved feed matched up with the route that serves it
+type resolvedDefinition struct {
+	builder feed.Builder
+	route   kindRoute
+	params  map[string]string
+	query   url.Values
+}
+
+func (s *Server) resolveDefinition(definition model.FeedDefinition) (resolvedDefinition, error) {
+	var resolved resolvedDefinition
+	index := slices.IndexFunc(s.providers, func(p provider) bool {
+		return p.Prefix == definition.Provider
+	})
+	if index < 0 || s.providers[index].builder == nil {
+		return resolved, fmt.Errorf("unknown provider %q", definition.Provider)
+	}
+	provider := s.providers[index]
+	kind := feed.Kind(definition.Kind)
+	route, ok := kindRoutes[kind]
+	if !ok || !slices.Contains(provider.Kinds, kind) {
+		return resolved, fmt.Errorf("provider %q doesn't support %q feeds", provider.Prefix, kind)
+	}
+	params := pathParamPattern.FindAllStringSubmatch(route.path, -1)
+	if len(definition.Slugs) != len(params) {
+		return resolved, fmt.Errorf("%q feeds require %d slugs", kind, len(params))
+	}
+	resolved.params = make(map[string]string)
+	for i, param := range params {
+		name, pattern := param[1], param[2]
+		slug := definition.Slugs[i]
+		if !regexp.MustCompile(fmt.Sprintf("^(%s)$", pattern)).MatchString(slug) {
+			return resolved, fmt.Errorf("invalid %s %q", name, slug)
+		}
+		resolved.params[name] = slug
+	}
+	if definition.Format != "" && !slices.Contains(formats, definition.Format) {
+		return resolved, fmt.Errorf("unknown format %q", definition.Format)
+	}
+	query := url.Values{}
+	for key, value := range definition.Filters {
+		query.Set(key, value)
+	}
+	if definition.Since != "" {
+		query.Set("since", definition.Since)
+	}
+	if definition.Until != "" {
+		query.Set("until", definition.Until)
+	}
+	if _, err := feed.ParseOptions(query); err != nil {
+		return resolved, err
+	}
+	resolved.builder = provider.builder
+	resolved.route = route
+	resolved.query = query
+	return resolved, nil
+}
+
+type savedDefinition struct {
+	Id  string `json:"id"`
+	Url string `json:"url"`
+}
+
+// definitionLimitReached responds when no more feeds can be saved
+func definitionLimitReached(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = w.Write([]byte("saved feed limit reached"))
+}
+
+func (s *Server) SaveDefinitionHandler(w http.ResponseWriter, r *http.Request) {
+	var definition model.FeedDefinition
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&definition); err != nil {
+		s.badRequest(fmt.Errorf("invalid feed definition: %w", err), w)
+		return
+	}
+	if definition.Format == "" {
+		definition.Format = "atom"
+	}
+	if _, err := s.resolveDefinition(definition); err != nil {
+		s.badRequest(err, w)
+		return
+	}
+	id, err := cache.SaveDefinition(definition)
+	if errors.Is(err, cache.ErrDefinitionLimit) {
+		definitionLimitReached(w)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Interface("definition", definition).Msg("Unable to save feed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Info().Str("id", id).Interface("definition", definition).Msg("Saved feed")
+	writeContentType("application/json", w)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(savedDefinition{
+		Id:  id,
+		Url: fmt.Sprintf("/f/%s.%s", id, definition.Format),
+	})
+}
+
+func (s *Server) SavedFeedHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	definition, ok := cache.GetDefinition(id)
+	if !ok {
+		s.notFound(fmt.Errorf("feed not found"), w)
+		return
+	}
+	resolved, err := s.resolveDefinition(definition)
+	if err != nil {
+		// the provider or feed kind may have been removed since it was saved
+		log.Error().Err(err).Str("id", id).Msg("Unable to resolve saved feed")
+		s.notFound(err, w)
+		return
+	}
+	resolved.serve(s, w, r)
+}
+
+// serve handles the request as if it was made to the route of the saved feed
+func (resolved resolvedDefinition) serve(s *Server, w http.ResponseWriter, r *http.Request) {
+	saved := r.Clone(r.Context())
+	saved.URL.RawQuery = resolved.query.Encode()
+	for name, value := range resolved.params {
+		saved.SetPathValue(name, value)
+	}
+	resolved.route.handler(s, resolved.builder)(w, saved)
+}
+
+// feedCapture is a http.ResponseWriter that keeps the feed passed to writeFeed,
+// so saved feeds can be built outside of a request
+type feedCapture struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	feed   *feed.Feed
+}
+
+func (c *feedCapture) Header() http.Header {
+	return c.header
+}
+
+func (c *feedCapture) Write(data []byte) (int, error) {
+	return c.body.Write(data)
+}
+
+func (c *feedCapture) WriteHeader(status int) {
+	c.status = status
+}
+
+// buildFeed returns the feed for a saved feed definition
+func (s *Server) buildFeed(ctx context.Context, id string) (*feed.Feed, error) {
+	definition, ok := cache.GetDefinition(id)
+	if !ok {
+		return nil, fmt.Errorf("feed %s not found", id)
+	}
+	resolved, err := s.resolveDefinition(definition)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "/f/"+id+".json", nil)
+	if err != nil {
+		return nil, err
+	}
+	r.SetPathValue("format", "json")
+	capture := &feedCapture{header: http.Header{}}
+	resolved.serve(s, capture, r)
+	if capture.feed == nil {
+		return nil, fmt.Errorf("feed %s failed with status %d: %s", id, capture.status, capture.body.String())
+	}
+	return capture.feed, nil
+}
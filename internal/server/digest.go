@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/email"
+	"github.com/RobBrazier/bookfeed/internal/model"
+	view "github.com/RobBrazier/bookfeed/internal/view/feed"
+	"github.com/a-h/templ"
+	"github.com/gorilla/feeds"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxDigests limits how many confirmed digests there can be across all feeds
+	maxDigests = 10_000
+	// maxPendingDigests limits how many digests can be waiting to be confirmed,
+	// so unconfirmed digests can't use up the confirmed ones
+	maxPendingDigests = 1_000
+	// maxPendingPerAddress limits the confirmation emails sent to an address
+	// until its digests are confirmed or expire
+	maxPendingPerAddress = 3
+	// pendingDigestExpiry is how long a digest has to be confirmed
+	pendingDigestExpiry = 48 * time.Hour
+)
+
+var digestPeriods = map[model.DigestFrequency]time.Duration{
+	model.DIGEST_DAILY:  24 * time.Hour,
+	model.DIGEST_WEEKLY: 7 * 24 * time.Hour,
+}
+
+type digestRequest struct {
+	Email     string                `json:"email"`
+	Frequency model.DigestFrequency `json:"frequency"`
+}
+
+func (s *Server) RegisterDigestHandler(w http.ResponseWriter, r *http.Request) {
+	base := publicBase()
+	if s.mailer == nil || base == "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("email digests aren't enabled"))
+		return
+	}
+	feedId := r.PathValue("id")
+	if _, ok := cache.GetDefinition(feedId); !ok {
+		s.notFound(fmt.Errorf("feed not found"), w)
+		return
+	}
+	var request digestRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16*1024))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		s.badRequest(fmt.Errorf("invalid digest: %w", err), w)
+		return
+	}
+	address, err := mail.ParseAddress(request.Email)
+	if err != nil {
+		s.badRequest(fmt.Errorf("invalid email: %w", err), w)
+		return
+	}
+	if request.Frequency == "" {
+		request.Frequency = model.DIGEST_WEEKLY
+	}
+	if _, ok := digestPeriods[request.Frequency]; !ok {
+		s.badRequest(fmt.Errorf("frequency must be daily or weekly"), w)
+		return
+	}
+	cache.ExpireDigests(time.Now().Add(-pendingDigestExpiry))
+	confirmed, pending, pendingAddress := 0, 0, 0
+	for _, digest := range cache.Digests() {
+		if digest.Confirmed {
+			confirmed++
+			continue
+		}
+		pending++
+		if strings.EqualFold(digest.Email, address.Address) {
+			pendingAddress++
+		}
+	}
+	if confirmed >= maxDigests || pending >= maxPendingDigests {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("digest limit reached"))
+		return
+	}
+	if pendingAddress >= maxPendingPerAddress {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("too many unconfirmed digests for this email"))
+		return
+	}
+	id := strings.ToLower(rand.Text()[:12])
+	digest := model.Digest{
+		Feed:      feedId,
+		Email:     address.Address,
+		Frequency: request.Frequency,
+		Token:     rand.Text(),
+		Created:   time.Now().UTC(),
+	}
+	// nothing is sent until the address is confirmed, so digests can't be
+	// used to send emails to people that didn't ask for them
+	confirm := fmt.Sprintf("%s/digests/%s/confirm?token=%s", base, id, digest.Token)
+	err = s.mailer.Send(email.Message{
+		To:      digest.Email,
+		Subject: "Confirm your bookfeed digest",
+		Html: fmt.Sprintf(
+			`<p>Confirm your %s digest of <a href="%s/f/%s.atom">this feed</a> by following <a href="%s">this link</a>.</p><p>If you didn't ask for this, you can ignore this email.</p>`,
+			digest.Frequency,
+			base,
+			feedId,
+			confirm,
+		),
+	})
+	if err != nil {
+		log.Error().Err(err).Str("feed", feedId).Msg("Unable to send digest confirmation")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("unable to send confirmation email"))
+		return
+	}
+	cache.SaveDigest(id, digest)
+	log.Info().Str("feed", feedId).Str("digest", id).Msg("Registered digest")
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte("check your email to confirm the digest"))
+}
+
+// digestFromRequest returns the digest for the request, if the token is valid
+func (s *Server) digestFromRequest(w http.ResponseWriter, r *http.Request) (string, model.Digest, bool) {
+	id := r.PathValue("digest")
+	digest, ok := cache.GetDigest(id)
+	token := r.URL.Query().Get("token")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(digest.Token)) != 1 {
+		s.notFound(fmt.Errorf("digest not found"), w)
+		return id, digest, false
+	}
+	return id, digest, true
+}
+
+// ConfirmDigestPageHandler asks to confirm the digest, which is done by
+// ConfirmDigestHandler
+func (s *Server) ConfirmDigestPageHandler(w http.ResponseWriter, r *http.Request) {
+	_, digest, ok := s.digestFromRequest(w, r)
+	if !ok {
+		return
+	}
+	page := view.ConfirmDigest(string(digest.Frequency), r.URL.RequestURI())
+	templ.Handler(page).ServeHTTP(w, r)
+}
+
+func (s *Server) ConfirmDigestHandler(w http.ResponseWriter, r *http.Request) {
+	id, digest, ok := s.digestFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !digest.Confirmed {
+		// build the feed first, so the items already in it are recorded in
+		// the history and aren't in the first digest
+		if _, err := s.buildFeed(r.Context(), digest.Feed); err != nil {
+			log.Warn().Err(err).Str("feed", digest.Feed).Msg("Unable to build feed for digest")
+		}
+		digest.Confirmed = true
+		digest.Sent = time.Now().UTC()
+		cache.SaveDigest(id, digest)
+		log.Info().Str("feed", digest.Feed).Str("digest", id).Msg("Confirmed digest")
+	}
+	_, _ = fmt.Fprintf(w, "Subscribed to a %s digest, the first will arrive once there are new releases", digest.Frequency)
+}
+
+// UnsubscribeDigestPageHandler asks to confirm unsubscribing, which is done
+// by UnsubscribeDigestHandler. Mail clients supporting one-click unsubscribe
+// POST to it directly
+func (s *Server) UnsubscribeDigestPageHandler(w http.ResponseWriter, r *http.Request) {
+	_, digest, ok := s.digestFromRequest(w, r)
+	if !ok {
+		return
+	}
+	page := view.UnsubscribeDigest(string(digest.Frequency), r.URL.RequestURI())
+	templ.Handler(page).ServeHTTP(w, r)
+}
+
+func (s *Server) UnsubscribeDigestHandler(w http.ResponseWriter, r *http.Request) {
+	id, digest, ok := s.digestFromRequest(w, r)
+	if !ok {
+		return
+	}
+	cache.DeleteDigest(id)
+	log.Info().Str("feed", digest.Feed).Str("digest", id).Msg("Unsubscribed digest")
+	_, _ = w.Write([]byte("Unsubscribed from the digest"))
+}
+
+// renderDigest renders the email for the items first seen since the last digest
+func renderDigest(
+	ctx context.Context,
+	base string,
+	id string,
+	digest model.Digest,
+	out *feeds.Feed,
+) (email.Message, bool, error) {
+	props := view.DigestProps{
+		Title: out.Title,
+		Unsubscribe: fmt.Sprintf(
+			"%s/digests/%s/unsubscribe?token=%s",
+			base,
+			id,
+			digest.Token,
+		),
+	}
+	if out.Link != nil {
+		props.Link = out.Link.Href
+	}
+	for _, item := range out.Items {
+		if !item.Updated.After(digest.Sent) {
+			continue
+		}
+		digestItem := view.DigestItem{Title: item.Title, Content: item.Content}
+		if item.Link != nil {
+			digestItem.Link = item.Link.Href
+		}
+		props.Items = append(props.Items, digestItem)
+	}
+	if len(props.Items) == 0 {
+		return email.Message{}, false, nil
+	}
+	var buf bytes.Buffer
+	if err := view.Digest(props).Render(ctx, &buf); err != nil {
+		return email.Message{}, false, err
+	}
+	return email.Message{
+		To:      digest.Email,
+		Subject: fmt.Sprintf("%s: %d new", out.Title, len(props.Items)),
+		Html:    buf.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%s>", props.Unsubscribe),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, true, nil
+}
+
+// deliverDigests emails the confirmed digests that are due. Failed digests
+// are retried on the next run
+func (s *Server) deliverDigests() {
+	base := publicBase()
+	if s.mailer == nil || base == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	now := time.Now().UTC()
+	if expired := cache.ExpireDigests(now.Add(-pendingDigestExpiry)); expired > 0 {
+		log.Info().Int("digests", expired).Msg("Removed unconfirmed digests")
+	}
+	due := make(map[string][]string)
+	digests := make(map[string]model.Digest)
+	for id, digest := range cache.Digests() {
+		if digest.Confirmed && !now.Before(digest.Sent.Add(digestPeriods[digest.Frequency])) {
+			due[digest.Feed] = append(due[digest.Feed], id)
+			digests[id] = digest
+		}
+	}
+	if len(digests) == 0 {
+		return
+	}
+	log.Info().Int("feeds", len(due)).Int("digests", len(digests)).Msg("Sending digests")
+
+	updated := make(map[string]model.Digest)
+	for feedId, ids := range due {
+		log := log.With().Str("feed", feedId).Logger()
+		out, err := s.buildFeed(ctx, feedId)
+		if err != nil {
+			log.Error().Err(err).Msg("Unable to build feed for digests")
+			continue
+		}
+		slices.Sort(ids)
+		for _, id := range ids {
+			digest := digests[id]
+			message, send, err := renderDigest(ctx, base, id, digest, &out.Feed)
+			if err != nil {
+				log.Error().Err(err).Str("digest", id).Msg("Unable to render digest")
+				continue
+			}
+			if send {
+				if err := s.mailer.Send(message); err != nil {
+					log.Error().Err(err).Str("digest", id).Msg("Unable to send digest")
+					continue
+				}
+			}
+			digest.Sent = now
+			updated[id] = digest
+		}
+	}
+	cache.UpdateDigests(updated)
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/email"
+	"github.com/RobBrazier/bookfeed/internal/email/smtptest"
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/gorilla/feeds"
+)
+
+// newDigestServer creates a server that sends emails to a local SMTP server
+func newDigestServer(t *testing.T, publicUrl string) (*Server, *smtptest.Server) {
+	t.Helper()
+	t.Setenv("CACHE_STORAGE_PATH", t.TempDir())
+	t.Setenv("PUBLIC_URL", publicUrl)
+	if err := config.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	smtp := smtptest.NewServer()
+	t.Cleanup(smtp.Close)
+	s := &Server{mailer: email.NewClient(smtp.Addr, "", "", "bookfeed@example.com")}
+	return s, smtp
+}
+
+func saveFeed(t *testing.T) string {
+	t.Helper()
+	id, err := cache.SaveDefinition(model.FeedDefinition{
+		Provider: "hc",
+		Kind:     "author",
+		Slugs:    []string{"brandon-sanderson"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// emailBody returns the decoded body of a message sent to the SMTP server
+func emailBody(t *testing.T, message smtptest.Message) string {
+	t.Helper()
+	parsed, err := mail.ReadMessage(bytes.NewReader(message.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+var confirmLink = regexp.MustCompile(`href="([^"]*/confirm\?token=[^"]*)"`)
+
+func TestDigestLifecycle(t *testing.T) {
+	s, smtp := newDigestServer(t, "https://bookfeed.example.com/")
+	routes := s.RegisterRoutes()
+	feedId := saveFeed(t)
+
+	// the links must not follow the headers of the request
+	body := strings.NewReader(`{"email": "reader@example.com", "frequency": "daily"}`)
+	r := httptest.NewRequest(
+		http.MethodPost,
+		"http://attacker.example/f/"+feedId+"/digests",
+		body,
+	)
+	r.Header.Set("X-Forwarded-Proto", "gopher")
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected registering to return 202, got %d: %s", w.Code, w.Body)
+	}
+
+	messages := smtp.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected a confirmation email, got %d emails", len(messages))
+	}
+	if to := messages[0].To; len(to) != 1 || to[0] != "reader@example.com" {
+		t.Errorf("expected the confirmation to be sent to reader@example.com, got %q", to)
+	}
+	match := confirmLink.FindStringSubmatch(emailBody(t, messages[0]))
+	if match == nil {
+		t.Fatal("expected a confirmation link in the email")
+	}
+	confirm := match[1]
+	base := "https://bookfeed.example.com/digests/"
+	if !strings.HasPrefix(confirm, base) {
+		t.Fatalf("expected the confirmation link to start with %q, got %q", base, confirm)
+	}
+	path := strings.TrimPrefix(confirm, "https://bookfeed.example.com")
+	digestId := strings.Split(path, "/")[2]
+
+	digest, ok := cache.GetDigest(digestId)
+	if !ok || digest.Confirmed {
+		t.Fatalf("expected an unconfirmed digest, got %+v", digest)
+	}
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `action="`+path+`"`) {
+		t.Errorf("expected a form to confirm the digest, got %d: %s", w.Code, w.Body)
+	}
+	if digest, _ := cache.GetDigest(digestId); digest.Confirmed {
+		t.Fatal("expected opening the confirmation link not to confirm the digest")
+	}
+
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected confirming to return 200, got %d: %s", w.Code, w.Body)
+	}
+	if digest, _ := cache.GetDigest(digestId); !digest.Confirmed {
+		t.Error("expected the digest to be confirmed")
+	}
+
+	unsubscribe := "/digests/" + digestId + "/unsubscribe?token=" + digest.Token
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, unsubscribe, nil))
+	form := `<form method="post" action="` + unsubscribe + `">`
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), form) {
+		t.Errorf("expected a form to confirm unsubscribing, got %d: %s", w.Code, w.Body)
+	}
+	if _, ok := cache.GetDigest(digestId); !ok {
+		t.Fatal("expected opening the unsubscribe link to keep the digest")
+	}
+
+	w = httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodPost, unsubscribe, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected unsubscribing to return 200, got %d: %s", w.Code, w.Body)
+	}
+	if _, ok := cache.GetDigest(digestId); ok {
+		t.Error("expected the digest to be deleted")
+	}
+}
+
+func TestDigestTokens(t *testing.T) {
+	s, _ := newDigestServer(t, "https://bookfeed.example.com")
+	routes := s.RegisterRoutes()
+	id := "abcdefghijkl"
+	cache.SaveDigest(id, model.Digest{
+		Feed:      saveFeed(t),
+		Email:     "reader@example.com",
+		Frequency: model.DIGEST_WEEKLY,
+		Token:     "TOKEN",
+		Confirmed: true,
+	})
+	t.Cleanup(func() { cache.DeleteDigest(id) })
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodGet, path: "/digests/" + id + "/confirm?token=WRONG"},
+		{method: http.MethodPost, path: "/digests/" + id + "/confirm?token=WRONG"},
+		{method: http.MethodGet, path: "/digests/" + id + "/unsubscribe?token=WRONG"},
+		{method: http.MethodPost, path: "/digests/" + id + "/unsubscribe"},
+		{method: http.MethodPost, path: "/digests/zzzzzzzzzzzz/unsubscribe?token=TOKEN"},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			if w.Code != http.StatusNotFound {
+				t.Errorf("expected 404, got %d", w.Code)
+			}
+			if _, ok := cache.GetDigest(id); !ok {
+				t.Error("expected the digest to be kept")
+			}
+		})
+	}
+}
+
+func TestDigestPendingLimits(t *testing.T) {
+	s, smtp := newDigestServer(t, "https://bookfeed.example.com")
+	routes := s.RegisterRoutes()
+	feedId := saveFeed(t)
+	t.Cleanup(func() {
+		for id, digest := range cache.Digests() {
+			if digest.Feed == feedId {
+				cache.DeleteDigest(id)
+			}
+		}
+	})
+	register := func(address string) int {
+		body := strings.NewReader(`{"email": "` + address + `"}`)
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/f/"+feedId+"/digests", body))
+		return w.Code
+	}
+
+	for range maxPendingPerAddress {
+		if code := register("reader@example.com"); code != http.StatusAccepted {
+			t.Fatalf("expected registering to return 202, got %d", code)
+		}
+	}
+	if code := register("Reader@Example.com"); code != http.StatusTooManyRequests {
+		t.Errorf("expected too many unconfirmed digests to return 429, got %d", code)
+	}
+	if code := register("other@example.com"); code != http.StatusAccepted {
+		t.Errorf("expected another address to be registered, got %d", code)
+	}
+	if sent := len(smtp.Messages()); sent != maxPendingPerAddress+1 {
+		t.Errorf("expected %d confirmation emails, got %d", maxPendingPerAddress+1, sent)
+	}
+
+	// unconfirmed digests expire, letting the address register again
+	for id, digest := range cache.Digests() {
+		if digest.Feed == feedId {
+			digest.Created = digest.Created.Add(-pendingDigestExpiry - time.Minute)
+			cache.SaveDigest(id, digest)
+		}
+	}
+	if code := register("reader@example.com"); code != http.StatusAccepted {
+		t.Errorf("expected registering after the digests expired to return 202, got %d", code)
+	}
+	pending := 0
+	for _, digest := range cache.Digests() {
+		if digest.Feed == feedId {
+			pending++
+		}
+	}
+	if pending != 1 {
+		t.Errorf("expected the expired digests to be removed, got %d digests", pending)
+	}
+}
+
+func TestDigestRequiresPublicUrl(t *testing.T) {
+	s, smtp := newDigestServer(t, "")
+	feedId := saveFeed(t)
+
+	body := strings.NewReader(`{"email": "reader@example.com"}`)
+	r := httptest.NewRequest(
+		http.MethodPost,
+		"http://bookfeed.example.com/f/"+feedId+"/digests",
+		body,
+	)
+	w := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected registering without PUBLIC_URL to return 503, got %d", w.Code)
+	}
+	if messages := smtp.Messages(); len(messages) != 0 {
+		t.Errorf("expected no emails to be sent, got %d", len(messages))
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	sent := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	digest := model.Digest{
+		Email:     "reader@example.com",
+		Frequency: model.DIGEST_WEEKLY,
+		Token:     "TOKEN",
+		Confirmed: true,
+		Sent:      sent,
+	}
+	out := &feeds.Feed{
+		Title: "Hardcover Author Releases: Brandon Sanderson",
+		Link:  &feeds.Link{Href: "https://hardcover.app/authors/brandon-sanderson"},
+		Items: []*feeds.Item{
+			{Title: "Wind and Truth", Updated: sent.AddDate(0, 0, 3)},
+			{Title: "Isles of the Emberdark", Updated: sent.AddDate(0, 0, 1)},
+			{Title: "The Sunlit Man", Updated: sent.AddDate(0, 0, -1)},
+			{Title: "Tress of the Emerald Sea", Updated: sent},
+		},
+	}
+	tests := []struct {
+		name  string
+		sent  time.Time
+		items []string
+	}{
+		{
+			name:  "items since the last digest",
+			sent:  sent,
+			items: []string{"Wind and Truth", "Isles of the Emberdark"},
+		},
+		{
+			name: "nothing new",
+			sent: sent.AddDate(0, 0, 3),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			digest := digest
+			digest.Sent = test.sent
+			message, send, err := renderDigest(
+				context.Background(),
+				"https://bookfeed.example.com",
+				"abcdefghijkl",
+				digest,
+				out,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if send != (test.items != nil) {
+				t.Fatalf("expected send to be %t, got %t", test.items != nil, send)
+			}
+			if !send {
+				return
+			}
+			for _, item := range out.Items {
+				included := strings.Contains(message.Html, item.Title)
+				if want := slices.Contains(test.items, item.Title); included != want {
+					t.Errorf("expected %q included to be %t, got %t", item.Title, want, included)
+				}
+			}
+			unsubscribe := "<https://bookfeed.example.com/digests/abcdefghijkl/unsubscribe" +
+				"?token=TOKEN>"
+			if header := message.Headers["List-Unsubscribe"]; header != unsubscribe {
+				t.Errorf("expected List-Unsubscribe %q, got %q", unsubscribe, header)
+			}
+			if message.To != digest.Email {
+				t.Errorf("expected the digest to be sent to %q, got %q", digest.Email, message.To)
+			}
+		})
+	}
+}
@@ -4,13 +4,21 @@ import (
 	"fmt"
 	"mime"
 	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/RobBrazier/bookfeed/internal/feed"
 	"github.com/gorilla/feeds"
 	"github.com/rs/zerolog/log"
 )
 
+// staleMaxAge is how long stale feeds can be cached for
+const staleMaxAge = 5 * time.Minute
+
 func writeContentType(mediaType string, w http.ResponseWriter) {
 	params := map[string]string{
 		"charset": "utf-8",
@@ -25,25 +33,61 @@ func (s *Server) notFound(err error, w http.ResponseWriter) {
 	_, _ = w.Write([]byte(err.Error()))
 }
 
-func (s *Server) writeFeed(format string, out *feeds.Feed, w http.ResponseWriter) {
+func (s *Server) badRequest(err error, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write([]byte(err.Error()))
+}
+
+func (s *Server) writeFeed(
+	format string,
+	out *feed.Feed,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	key, topics := topicUrls(r, format)
+	if !out.Stale {
+		s.publish(key, topics, &out.Feed)
+	}
+	if capture, ok := w.(*feedCapture); ok {
+		capture.feed = out
+		return
+	}
 	// Set Cloudflare cache header for 1 hour (3600 seconds)
 	// This is shorter than our data cache (6 hours) to ensure freshness
 	w.Header().Set("Last-Modified", out.Created.Format("Mon, 02 Jan 2006 15:04:05 GMT"))
 	cacheExpiry := out.Created.Add(12 * time.Hour)
 	remaining := cacheExpiry.Sub(time.Now().UTC())
+	if out.Stale {
+		// check back soon, in case the provider has recovered
+		w.Header().Set("X-Bookfeed-Stale", "true")
+		remaining = staleMaxAge
+	}
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(remaining.Seconds())))
 	var err error
 
+	// the hub is only advertised for feeds that are published to it
+	var links feedLinks
+	if len(topics) > 0 {
+		links = feedLinks{self: topics[0], hub: config.WebSubHub()}
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"self\"", links.self))
+	}
+	if links.hub != "" {
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"hub\"", links.hub))
+	}
+
 	switch format {
+	case "ics":
+		writeContentType("text/calendar", w)
+		err = writeCalendar(&out.Feed, links.self, w)
 	case "rss":
 		writeContentType("application/rss+xml", w)
-		err = out.WriteRss(w)
+		err = feeds.WriteXML(links.rss(&out.Feed), w)
 	case "json":
 		writeContentType("application/json", w)
-		err = out.WriteJSON(w)
+		err = writeJSONFeed(out, links, w)
 	default:
 		writeContentType("application/atom+xml", w)
-		err = out.WriteAtom(w)
+		err = feeds.WriteXML(links.atom(&out.Feed), w)
 	}
 	if err != nil {
 		log.Error().
@@ -54,55 +98,235 @@ func (s *Server) writeFeed(format string, out *feeds.Feed, w http.ResponseWriter
 	}
 }
 
-func (s *Server) RecentHandler(w http.ResponseWriter, r *http.Request) {
+// parseOptions returns the output format and feed options for a request
+func parseOptions(r *http.Request) (string, feed.Options, error) {
 	format := strings.ToLower(r.PathValue("format"))
-	feed, err := s.builder.GetRecentReleases(r.Context())
-	if err != nil {
-		log.Error().Err(err).Msg("error retrieving recent")
+	opts, err := feed.ParseOptions(r.URL.Query())
+	opts.Calendar = format == string(feed.FORMAT_ICS)
+	return format, opts, err
+}
+
+func (s *Server) RecentHandler(builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, opts, err := parseOptions(r)
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		feed, err := builder.GetRecentReleases(r.Context(), opts)
+		if err != nil {
+			// recent releases are never missing, so the provider failed
+			log.Error().Err(err).Msg("error retrieving recent")
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for recent releases")
+		s.writeFeed(format, &feed, w, r)
 	}
-	log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for recent releases")
-	s.writeFeed(format, &feed, w)
 }
 
-func (s *Server) AuthorHandler(w http.ResponseWriter, r *http.Request) {
-	format := strings.ToLower(r.PathValue("format"))
-	author := strings.ToLower(r.PathValue("author"))
-	log := log.With().Str("author", author).Logger()
-	feed, err := s.builder.GetAuthorReleases(r.Context(), author)
-	if err != nil {
-		log.Error().Err(err).Msg("error retrieving author")
-		s.notFound(err, w)
-		return
+func (s *Server) AuthorHandler(builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, opts, err := parseOptions(r)
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		author := strings.ToLower(r.PathValue("author"))
+		log := log.With().Str("author", author).Logger()
+		feed, err := builder.GetAuthorReleases(r.Context(), author, opts)
+		if err != nil {
+			log.Error().Err(err).Msg("error retrieving author")
+			s.notFound(err, w)
+			return
+		}
+		log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for author")
+		s.writeFeed(format, &feed, w, r)
 	}
-	log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for author")
-	s.writeFeed(format, &feed, w)
 }
 
-func (s *Server) SeriesHandler(w http.ResponseWriter, r *http.Request) {
-	format := strings.ToLower(r.PathValue("format"))
-	series := strings.ToLower(r.PathValue("series"))
-	log := log.With().Str("series", series).Logger()
-	feed, err := s.builder.GetSeriesReleases(r.Context(), series)
-	if err != nil {
-		log.Error().Err(err).Msg("error retrieving series")
-		s.notFound(err, w)
-		return
+func (s *Server) SeriesHandler(builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, opts, err := parseOptions(r)
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		series := strings.ToLower(r.PathValue("series"))
+		log := log.With().Str("series", series).Logger()
+		feed, err := builder.GetSeriesReleases(r.Context(), series, opts)
+		if err != nil {
+			log.Error().Err(err).Msg("error retrieving series")
+			s.notFound(err, w)
+			return
+		}
+		log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for series")
+		s.writeFeed(format, &feed, w, r)
 	}
-	log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for series")
-	s.writeFeed(format, &feed, w)
 }
 
-func (s *Server) MeHandler(w http.ResponseWriter, r *http.Request) {
-	format := strings.ToLower(r.PathValue("format"))
-	user := strings.ToLower(r.PathValue("username"))
-	filter := strings.ToLower(r.URL.Query().Get("filter"))
-	log := log.With().Str("user", user).Str("filter", filter).Logger()
-	feed, err := s.builder.GetUserReleases(r.Context(), user, filter)
-	if err != nil {
-		log.Error().Err(err).Msg("error retrieving user")
-		s.notFound(err, w)
-		return
+func (s *Server) MeHandler(builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, opts, err := parseOptions(r)
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		user := strings.ToLower(r.PathValue("username"))
+		filter := strings.ToLower(r.URL.Query().Get("filter"))
+		log := log.With().Str("user", user).Str("filter", filter).Logger()
+		feed, err := builder.GetUserReleases(r.Context(), user, filter, opts)
+		if err != nil {
+			log.Error().Err(err).Msg("error retrieving user")
+			s.notFound(err, w)
+			return
+		}
+		log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for user")
+		s.writeFeed(format, &feed, w, r)
+	}
+}
+
+func (s *Server) ListHandler(builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, opts, err := parseOptions(r)
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		user := strings.ToLower(r.PathValue("username"))
+		list := strings.ToLower(r.PathValue("list"))
+		log := log.With().Str("user", user).Str("list", list).Logger()
+		feed, err := builder.GetListReleases(r.Context(), user, list, opts)
+		if err != nil {
+			log.Error().Err(err).Msg("error retrieving list")
+			s.notFound(err, w)
+			return
+		}
+		log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for list")
+		s.writeFeed(format, &feed, w, r)
+	}
+}
+
+func (s *Server) PublisherHandler(builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, opts, err := parseOptions(r)
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		publisher := strings.ToLower(r.PathValue("publisher"))
+		imprints, _ := strconv.ParseBool(r.URL.Query().Get("imprints"))
+		log := log.With().Str("publisher", publisher).Bool("imprints", imprints).Logger()
+		feed, err := builder.GetPublisherReleases(r.Context(), publisher, imprints, opts)
+		if err != nil {
+			log.Error().Err(err).Msg("error retrieving publisher")
+			s.notFound(err, w)
+			return
+		}
+		log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for publisher")
+		s.writeFeed(format, &feed, w, r)
+	}
+}
+
+var slugPattern = regexp.MustCompile("^[a-z0-9-]+$")
+
+// splitSlugs normalises comma separated lists of slugs, so the same
+// combination of slugs always shares a cache entry
+func splitSlugs(values ...string) ([]string, error) {
+	var slugs []string
+	for _, value := range values {
+		for slug := range strings.SplitSeq(value, ",") {
+			slug = strings.ToLower(strings.TrimSpace(slug))
+			if slug == "" || slices.Contains(slugs, slug) {
+				continue
+			}
+			if !slugPattern.MatchString(slug) {
+				return nil, fmt.Errorf("invalid slug %q", slug)
+			}
+			slugs = append(slugs, slug)
+		}
+	}
+	slices.Sort(slugs)
+	return slugs, nil
+}
+
+func (s *Server) GenreHandler(builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, opts, err := parseOptions(r)
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		tags, err := splitSlugs(r.PathValue("tag"), r.URL.Query().Get("tags"))
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		exclude, err := splitSlugs(r.URL.Query().Get("exclude"))
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		for _, tag := range exclude {
+			if slices.Contains(tags, tag) {
+				s.badRequest(fmt.Errorf("tag %q can't be both included and excluded", tag), w)
+				return
+			}
+		}
+		log := log.With().Strs("tags", tags).Strs("exclude", exclude).Logger()
+		feed, err := builder.GetGenreReleases(r.Context(), tags, exclude, opts)
+		if err != nil {
+			log.Error().Err(err).Msg("error retrieving genre")
+			s.notFound(err, w)
+			return
+		}
+		log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for genre")
+		s.writeFeed(format, &feed, w, r)
+	}
+}
+
+// maxMixSlugs limits how many authors, series and genres a mix can combine
+const maxMixSlugs = 50
+
+func (s *Server) MixHandler(builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		format, opts, err := parseOptions(r)
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		var slugs [3][]string
+		for i, param := range []string{"author", "series", "genre"} {
+			slugs[i], err = splitSlugs(query[param]...)
+			if err != nil {
+				s.badRequest(err, w)
+				return
+			}
+		}
+		authors, series, genres := slugs[0], slugs[1], slugs[2]
+		count := len(authors) + len(series) + len(genres)
+		if count == 0 {
+			s.badRequest(fmt.Errorf("at least one author, series or genre is required"), w)
+			return
+		}
+		if count > maxMixSlugs {
+			s.badRequest(fmt.Errorf("a mix can't include more than %d entries", maxMixSlugs), w)
+			return
+		}
+		log := log.With().
+			Strs("authors", authors).
+			Strs("series", series).
+			Strs("genres", genres).
+			Logger()
+		feed, err := builder.GetMixReleases(r.Context(), authors, series, genres, opts)
+		if err != nil {
+			log.Error().Err(err).Msg("error retrieving mix")
+			s.notFound(err, w)
+			return
+		}
+		log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for mix")
+		s.writeFeed(format, &feed, w, r)
 	}
-	log.Info().Int("entries", len(feed.Items)).Msg("Generated feed for user")
-	s.writeFeed(format, &feed, w)
 }
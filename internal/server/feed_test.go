@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/feed"
+	"github.com/RobBrazier/bookfeed/internal/hardcover/hardcovertest"
+)
+
+var hcNow = time.Date(2025, 11, 1, 12, 0, 0, 0, time.UTC)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("../hardcover/testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// newHardcoverClient answers the queries behind the author, series, user and
+// mix feeds from the fixtures
+func newHardcoverClient(t *testing.T) *hardcovertest.Client {
+	t.Helper()
+	authors := readFixture(t, "authors.json")
+	series := readFixture(t, "series.json")
+	return hardcovertest.NewClient(map[string]hardcovertest.Response{
+		"RecentAuthorReleases":     hardcovertest.Matching(authors, "authors"),
+		"RecentAuthorReleasesById": hardcovertest.Matching(authors, "authors"),
+		"RecentSeriesReleases":     hardcovertest.Matching(series, "series"),
+		"RecentSeriesReleasesById": hardcovertest.Matching(series, "series"),
+		"UserInterests": hardcovertest.Respond(
+			string(readFixture(t, "user_interests.json")),
+		),
+	})
+}
+
+// newTestServer creates a server with Hardcover feeds loaded with the client
+func newTestServer(client *hardcovertest.Client) (*Server, *cache.Caches) {
+	deps := feed.Deps{Caches: cache.NewCaches(nil), Now: func() time.Time { return hcNow }}
+	s := &Server{
+		providers: newProviders(deps),
+		published: newPublishedCache(),
+	}
+	for i, provider := range s.providers {
+		if provider.Prefix == "hc" {
+			s.providers[i].builder = feed.NewHardcoverBuilder(
+				client,
+				deps.Caches,
+				deps.Now,
+				feed.HardcoverOptions{},
+			)
+		}
+	}
+	return s, deps.Caches
+}
+
+// newFeedServer serves Hardcover feeds loaded with the client
+func newFeedServer(client *hardcovertest.Client) (http.Handler, *cache.Caches) {
+	s, caches := newTestServer(client)
+	return s.feedRoutes(), caches
+}
+
+func getFeed(routes http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+// atomSubtitle returns the description of an Atom feed
+func atomSubtitle(t *testing.T, body []byte) string {
+	t.Helper()
+	var atom struct {
+		Subtitle string `xml:"subtitle"`
+	}
+	if err := xml.Unmarshal(body, &atom); err != nil {
+		t.Fatal(err)
+	}
+	return atom.Subtitle
+}
+
+var feedPaths = []struct {
+	name string
+	path string
+}{
+	{name: "author", path: "/hc/author/brandon-sanderson.atom"},
+	{name: "series", path: "/hc/series/the-stormlight-archive.atom"},
+	{name: "user", path: "/hc/me/reader.atom"},
+	{name: "mix", path: "/hc/mix.atom?author=robin-hobb&series=the-stormlight-archive"},
+}
+
+const staleNote = "Hardcover couldn't be reached, so this feed shows releases as of " +
+	"01 Nov 2025 12:00:00 (+0000)"
+
+func TestFeedServedStaleWhenHardcoverFails(t *testing.T) {
+	for _, test := range feedPaths {
+		t.Run(test.name, func(t *testing.T) {
+			client := newHardcoverClient(t)
+			routes, caches := newFeedServer(client)
+
+			fresh := getFeed(routes, test.path)
+			if fresh.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", fresh.Code, fresh.Body)
+			}
+			if fresh.Header().Get("X-Bookfeed-Stale") != "" {
+				t.Error("expected the feed not to be stale")
+			}
+			subtitle := atomSubtitle(t, fresh.Body.Bytes())
+			if strings.Contains(subtitle, staleNote) {
+				t.Errorf("expected no stale note, got %q", subtitle)
+			}
+
+			// Hardcover goes down after the data has expired
+			client.Fail(errors.New("hardcover is down"))
+			caches.Collections.InvalidateAll()
+			caches.Users.InvalidateAll()
+
+			stale := getFeed(routes, test.path)
+			if stale.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", stale.Code, stale.Body)
+			}
+			if header := stale.Header().Get("X-Bookfeed-Stale"); header != "true" {
+				t.Errorf("expected X-Bookfeed-Stale to be true, got %q", header)
+			}
+			subtitle = atomSubtitle(t, stale.Body.Bytes())
+			if !strings.Contains(subtitle, staleNote) {
+				t.Errorf("expected the description to note the feed is stale, got %q", subtitle)
+			}
+			if cacheControl := stale.Header().Get("Cache-Control"); cacheControl != "max-age=300" {
+				t.Errorf("expected a stale feed to be cached briefly, got %q", cacheControl)
+			}
+		})
+	}
+}
+
+func TestFeedFailsWithoutLastGoodData(t *testing.T) {
+	paths := append(feedPaths, struct {
+		name string
+		path string
+	}{name: "mix calendar", path: "/hc/mix.ics?author=robin-hobb"})
+	for _, test := range paths {
+		t.Run(test.name, func(t *testing.T) {
+			client := newHardcoverClient(t)
+			client.Fail(errors.New("hardcover is down"))
+			routes, _ := newFeedServer(client)
+
+			w := getFeed(routes, test.path)
+			if w.Code == http.StatusOK {
+				t.Errorf("expected the feed to fail, got 200: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestMixFailsWhenPartLoadFails(t *testing.T) {
+	authors := readFixture(t, "authors.json")
+	client := hardcovertest.NewClient(map[string]hardcovertest.Response{
+		"RecentAuthorReleases": hardcovertest.Matching(authors, "authors"),
+		"RecentSeriesReleases": func(map[string]any) (string, error) {
+			return "", errors.New("series query timed out")
+		},
+	})
+	routes, _ := newFeedServer(client)
+
+	w := getFeed(routes, "/hc/mix.atom?author=robin-hobb&series=the-stormlight-archive")
+	if w.Code == http.StatusOK {
+		t.Errorf("expected the mix to fail rather than leave out the series, got 200: %s", w.Body)
+	}
+}
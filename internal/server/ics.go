@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gorilla/feeds"
+)
+
+var icsEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// icsWriter writes iCalendar content lines, folded to 75 octets
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *icsWriter) line(name, value string) {
+	if w.err != nil {
+		return
+	}
+	line := name + ":" + value
+	// continuation lines start with a space, which counts towards the limit
+	limit := 75
+	for len(line) > limit {
+		// don't split multi-byte characters when folding
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		_, w.err = w.w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	if w.err == nil {
+		_, w.err = w.w.WriteString(line + "\r\n")
+	}
+}
+
+// writeCalendar writes the feed as an iCalendar, with an all-day event for each
+// item. Items are expected to be dated on release day (see Options.Calendar)
+func writeCalendar(out *feeds.Feed, self string, w io.Writer) error {
+	writer := &icsWriter{w: bufio.NewWriter(w)}
+	writer.line("BEGIN", "VCALENDAR")
+	writer.line("VERSION", "2.0")
+	writer.line("PRODID", "-//bookfeed//bookfeed//EN")
+	writer.line("CALSCALE", "GREGORIAN")
+	writer.line("METHOD", "PUBLISH")
+	writer.line("X-WR-CALNAME", icsEscaper.Replace(out.Title))
+	if self != "" {
+		writer.line("SOURCE;VALUE=URI", self)
+	}
+	writer.line("REFRESH-INTERVAL;VALUE=DURATION", "PT12H")
+	writer.line("X-PUBLISHED-TTL", "PT12H")
+	for _, item := range out.Items {
+		stamp := item.Updated
+		if stamp.IsZero() {
+			stamp = out.Created
+		}
+		day := item.Created.UTC()
+		writer.line("BEGIN", "VEVENT")
+		writer.line("UID", fmt.Sprintf("book-%s@bookfeed", item.Id))
+		writer.line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		writer.line("DTSTART;VALUE=DATE", day.Format("20060102"))
+		writer.line("DTEND;VALUE=DATE", day.AddDate(0, 0, 1).Format("20060102"))
+		writer.line("SUMMARY", icsEscaper.Replace(item.Title))
+		var description []string
+		if item.Author != nil && item.Author.Name != "" {
+			description = append(description, "By "+item.Author.Name)
+		}
+		if item.Link != nil && item.Link.Href != "" {
+			writer.line("URL;VALUE=URI", item.Link.Href)
+			description = append(description, item.Link.Href)
+		}
+		if len(description) > 0 {
+			writer.line("DESCRIPTION", icsEscaper.Replace(strings.Join(description, "\n")))
+		}
+		writer.line("TRANSP", "TRANSPARENT")
+		writer.line("END", "VEVENT")
+	}
+	writer.line("END", "VCALENDAR")
+	if writer.err != nil {
+		return writer.err
+	}
+	return writer.w.Flush()
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/feed"
+	"github.com/RobBrazier/bookfeed/internal/imports"
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxImportSize limits the size of uploaded files
+	maxImportSize = 10 * 1024 * 1024
+	// maxImportNames limits how many names of each kind are resolved, which
+	// are the most referenced in the import
+	maxImportNames = 200
+)
+
+type importedName struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type importResult struct {
+	savedDefinition
+	Authors    []importedName `json:"authors"`
+	Series     []importedName `json:"series"`
+	Unresolved []string       `json:"unresolved"`
+	// Skipped is how many were found, but didn't fit in the feed
+	Skipped int `json:"skipped"`
+}
+
+type rankedName struct {
+	importedName
+	kind  feed.Kind
+	count int
+}
+
+// resolveCandidates looks up the slugs of the most referenced candidates,
+// returning those that were found along with the names that weren't
+func resolveCandidates(
+	r *http.Request,
+	builder feed.Builder,
+	kind feed.Kind,
+	candidates []imports.Candidate,
+) ([]rankedName, []string, error) {
+	candidates = candidates[:min(len(candidates), maxImportNames)]
+	var names []string
+	for _, candidate := range candidates {
+		if candidate.Slug == "" {
+			names = append(names, candidate.Name)
+		}
+	}
+	resolved := map[string]model.Interest{}
+	if len(names) > 0 {
+		var err error
+		resolved, err = builder.ResolveNames(r.Context(), kind, names)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var found []rankedName
+	var unresolved []string
+	for _, candidate := range candidates {
+		name := importedName{Name: candidate.Name, Slug: candidate.Slug}
+		if interest, ok := resolved[candidate.Name]; ok {
+			name = importedName{Name: interest.Name, Slug: interest.Slug}
+		}
+		if name.Slug == "" {
+			unresolved = append(unresolved, candidate.Name)
+			continue
+		}
+		found = append(found, rankedName{importedName: name, kind: kind, count: candidate.Count})
+	}
+	return found, unresolved, nil
+}
+
+// ImportHandler turns an uploaded OPML file or library export into a saved
+// mix feed of the authors and series in it
+func (s *Server) ImportHandler(prefix string, builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			s.badRequest(fmt.Errorf("a file is required: %w", err), w)
+			return
+		}
+		defer file.Close()
+		format := strings.ToLower(r.FormValue("format"))
+		if format == "" {
+			format = string(feed.FORMAT_ATOM)
+		}
+		if !slices.Contains(formats, format) {
+			s.badRequest(fmt.Errorf("unknown format %q", format), w)
+			return
+		}
+		parsed, err := imports.Parse(file)
+		if err != nil {
+			s.badRequest(err, w)
+			return
+		}
+
+		result := importResult{
+			Authors:    []importedName{},
+			Series:     []importedName{},
+			Unresolved: []string{},
+		}
+		var ranked []rankedName
+		for _, part := range []struct {
+			kind       feed.Kind
+			candidates []imports.Candidate
+		}{
+			{feed.KIND_AUTHOR, parsed.Authors},
+			{feed.KIND_SERIES, parsed.Series},
+		} {
+			found, unresolved, err := resolveCandidates(r, builder, part.kind, part.candidates)
+			if errors.Is(err, feed.ErrUnsupported) {
+				s.notFound(err, w)
+				return
+			}
+			if err != nil {
+				log.Error().Err(err).Str("kind", string(part.kind)).Msg("Unable to resolve import")
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			ranked = append(ranked, found...)
+			result.Unresolved = append(result.Unresolved, unresolved...)
+		}
+
+		// keep the most referenced authors and series that fit in a mix
+		slices.SortStableFunc(ranked, func(a, b rankedName) int {
+			return b.count - a.count
+		})
+		filters := map[string][]string{}
+		for _, name := range ranked {
+			param := string(name.kind)
+			if slices.Contains(filters[param], name.Slug) {
+				continue
+			}
+			if len(filters["author"])+len(filters["series"]) >= maxMixSlugs {
+				result.Skipped++
+				continue
+			}
+			filters[param] = append(filters[param], name.Slug)
+			if name.kind == feed.KIND_AUTHOR {
+				result.Authors = append(result.Authors, name.importedName)
+			} else {
+				result.Series = append(result.Series, name.importedName)
+			}
+		}
+		if len(filters) == 0 {
+			s.badRequest(fmt.Errorf("no authors or series in the file were found"), w)
+			return
+		}
+
+		definition := model.FeedDefinition{
+			Provider: prefix,
+			Kind:     string(feed.KIND_MIX),
+			Filters:  map[string]string{},
+			Format:   format,
+		}
+		for param, slugs := range filters {
+			slices.Sort(slugs)
+			definition.Filters[param] = strings.Join(slugs, ",")
+		}
+		if _, err := s.resolveDefinition(definition); err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		id, err := cache.SaveDefinition(definition)
+		if errors.Is(err, cache.ErrDefinitionLimit) {
+			definitionLimitReached(w)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Interface("definition", definition).Msg("Unable to save import")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		log.Info().
+			Str("id", id).
+			Int("authors", len(result.Authors)).
+			Int("series", len(result.Series)).
+			Int("unresolved", len(result.Unresolved)).
+			Msg("Imported feed")
+		result.savedDefinition = savedDefinition{
+			Id:  id,
+			Url: fmt.Sprintf("/f/%s.%s", id, format),
+		}
+		writeContentType("application/json", w)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
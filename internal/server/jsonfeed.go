@@ -0,0 +1,211 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/feed"
+	"github.com/RobBrazier/bookfeed/internal/model"
+)
+
+const (
+	jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+	// jsonFeedAbout documents the _bookfeed extension objects
+	jsonFeedAbout = "https://github.com/RobBrazier/bookfeed#json-feed"
+)
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageUrl string         `json:"home_page_url,omitempty"`
+	FeedUrl     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Hubs        []jsonFeedHub  `json:"hubs,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedHub struct {
+	Type string `json:"type"`
+	Url  string `json:"url"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	Id            string           `json:"id"`
+	Url           string           `json:"url,omitempty"`
+	Title         string           `json:"title"`
+	ContentHtml   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	BannerImage   string           `json:"banner_image,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	Bookfeed      *bookfeedBook    `json:"_bookfeed,omitempty"`
+}
+
+// bookfeedBook is the _bookfeed extension object, with the structured details
+// of the book behind an item
+type bookfeedBook struct {
+	About       string           `json:"about"`
+	Id          int              `json:"id"`
+	Slug        string           `json:"slug,omitempty"`
+	Title       string           `json:"title"`
+	Upcoming    bool             `json:"upcoming"`
+	ReleaseDate string           `json:"release_date,omitempty"`
+	Announced   string           `json:"announced,omitempty"`
+	Added       string           `json:"added,omitempty"`
+	FirstSeen   string           `json:"first_seen,omitempty"`
+	Compilation bool             `json:"compilation"`
+	Headline    string           `json:"headline,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Authors     []string         `json:"authors,omitempty"`
+	Genres      []string         `json:"genres,omitempty"`
+	Series      *bookfeedSeries  `json:"series,omitempty"`
+	Cover       *bookfeedCover   `json:"cover,omitempty"`
+	Edition     *bookfeedEdition `json:"edition,omitempty"`
+}
+
+type bookfeedSeries struct {
+	Title    string  `json:"title"`
+	Position float32 `json:"position,omitempty"`
+}
+
+type bookfeedCover struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+type bookfeedEdition struct {
+	Format      string   `json:"format,omitempty"`
+	ReleaseDate string   `json:"release_date,omitempty"`
+	Publisher   string   `json:"publisher,omitempty"`
+	Narrators   []string `json:"narrators,omitempty"`
+	Isbn13      string   `json:"isbn_13,omitempty"`
+	Asin        string   `json:"asin,omitempty"`
+	Duration    int      `json:"duration_seconds,omitempty"`
+}
+
+func jsonDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format(time.DateOnly)
+}
+
+func jsonTime(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format(time.RFC3339)
+}
+
+func newBookfeedBook(entry model.Entry) *bookfeedBook {
+	book := entry.Book
+	result := &bookfeedBook{
+		About:       jsonFeedAbout,
+		Id:          book.Id,
+		Slug:        book.Slug,
+		Title:       book.Title,
+		Upcoming:    entry.Upcoming,
+		ReleaseDate: jsonDate(book.ReleaseDate),
+		Announced:   jsonTime(book.Announced),
+		Added:       jsonTime(book.Added),
+		FirstSeen:   jsonTime(entry.FirstSeen),
+		Compilation: book.Compilation,
+		Headline:    book.Headline,
+		Description: book.Description,
+		Authors:     book.Authors,
+		Genres:      book.Genres,
+	}
+	if book.Series.Title != "" {
+		result.Series = &bookfeedSeries{
+			Title:    book.Series.Title,
+			Position: book.Series.Position,
+		}
+	}
+	if book.Image.Url != "" {
+		result.Cover = &bookfeedCover{
+			Url:    book.Image.Url,
+			Width:  book.Image.Width,
+			Height: book.Image.Height,
+		}
+	}
+	if edition := book.Edition; edition.Format != "" || !edition.ReleaseDate.IsZero() {
+		result.Edition = &bookfeedEdition{
+			Format:      edition.Format,
+			ReleaseDate: jsonDate(edition.ReleaseDate),
+			Publisher:   edition.Publisher,
+			Narrators:   edition.Narrators,
+			Isbn13:      edition.Isbn13,
+			Asin:        edition.Asin,
+			Duration:    int(edition.Duration.Seconds()),
+		}
+	}
+	return result
+}
+
+// contributors returns everyone credited on the book, authors first
+func contributors(book model.Book) (authors []jsonFeedAuthor) {
+	var names []string
+	for _, name := range slices.Concat(book.Authors, book.Edition.Narrators) {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+			authors = append(authors, jsonFeedAuthor{Name: name})
+		}
+	}
+	return authors
+}
+
+// writeJSONFeed writes the feed as a JSON Feed 1.1, with the details of each
+// book in a _bookfeed extension object
+func writeJSONFeed(out *feed.Feed, links feedLinks, w io.Writer) error {
+	result := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       out.Title,
+		FeedUrl:     links.self,
+		Description: out.Description,
+		Items:       []jsonFeedItem{},
+	}
+	if out.Link != nil {
+		result.HomePageUrl = out.Link.Href
+	}
+	if links.hub != "" {
+		result.Hubs = []jsonFeedHub{{Type: "WebSub", Url: links.hub}}
+	}
+	for _, item := range out.Items {
+		jsonItem := jsonFeedItem{
+			Id:            item.Id,
+			Title:         item.Title,
+			ContentHtml:   item.Content,
+			DatePublished: jsonTime(item.Created),
+			DateModified:  jsonTime(item.Updated),
+		}
+		if item.Link != nil {
+			jsonItem.Url = item.Link.Href
+		}
+		if entry, ok := out.Entries[item.Id]; ok {
+			book := entry.Book
+			jsonItem.Summary = book.Headline
+			jsonItem.Image = book.Image.Url
+			jsonItem.BannerImage = book.Image.Url
+			jsonItem.Authors = contributors(book)
+			jsonItem.Tags = book.Genres
+			jsonItem.Bookfeed = newBookfeedBook(entry)
+		} else if item.Author != nil && item.Author.Name != "" {
+			jsonItem.Authors = []jsonFeedAuthor{{Name: item.Author.Name}}
+		}
+		result.Items = append(result.Items, jsonItem)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(result)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/feed"
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+type opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated"`
+	Docs        string `xml:"docs"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XmlUrl   string        `xml:"xmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+func writeOpml(doc opml, w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// interestOutlines returns a folder with a feed for each of the interests,
+// or nothing if there aren't any
+func interestOutlines(
+	text, prefix, kind string,
+	interests []model.Interest,
+	query string,
+) []opmlOutline {
+	if len(interests) == 0 {
+		return nil
+	}
+	folder := opmlOutline{Text: text}
+	for _, interest := range interests {
+		folder.Outlines = append(folder.Outlines, opmlOutline{
+			Text:   interest.Name,
+			Title:  interest.Name,
+			Type:   "rss",
+			XmlUrl: fmt.Sprintf("%s/%s/%s.%s%s", prefix, kind, interest.Slug, feed.FORMAT_ATOM, query),
+		})
+	}
+	return []opmlOutline{folder}
+}
+
+// OpmlHandler lists the individual author and series feeds behind a user's
+// releases feed, so they can be imported into a reader and pruned
+func (s *Server) OpmlHandler(prefix string, builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if _, err := feed.ParseOptions(query); err != nil {
+			s.badRequest(err, w)
+			return
+		}
+		user := strings.ToLower(r.PathValue("username"))
+		filter := strings.ToLower(query.Get("filter"))
+		log := log.With().Str("user", user).Str("filter", filter).Logger()
+		interests, err := builder.GetUserInterests(r.Context(), user, filter)
+		if err != nil {
+			log.Error().Err(err).Msg("error retrieving user interests")
+			s.notFound(err, w)
+			return
+		}
+
+		// the release options apply to each of the individual feeds
+		query.Del("filter")
+		root := fmt.Sprintf("%s/%s", baseUrl(r), prefix)
+		doc := opml{
+			Version: "2.0",
+			Head: opmlHead{
+				Title:       fmt.Sprintf("Hardcover Subscriptions: %s", user),
+				DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+				Docs:        "http://opml.org/spec2.opml",
+			},
+		}
+		var encoded string
+		if len(query) > 0 {
+			encoded = "?" + query.Encode()
+		}
+		if filter == "wishlist" {
+			// the shelf can't be split up, so the only feed is the shelf itself
+			query.Set("filter", filter)
+			title := fmt.Sprintf("Want to Read: %s", user)
+			doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{
+				Text:   title,
+				Title:  title,
+				Type:   "rss",
+				XmlUrl: fmt.Sprintf("%s/me/%s.%s?%s", root, user, feed.FORMAT_ATOM, query.Encode()),
+			})
+		}
+		doc.Body.Outlines = append(
+			doc.Body.Outlines,
+			interestOutlines("Authors", root, "author", interests.Authors, encoded)...,
+		)
+		doc.Body.Outlines = append(
+			doc.Body.Outlines,
+			interestOutlines("Series", root, "series", interests.Series, encoded)...,
+		)
+		log.Info().
+			Int("authors", len(interests.Authors)).
+			Int("series", len(interests.Series)).
+			Msg("Generated subscriptions for user")
+
+		filename := url.PathEscape(fmt.Sprintf("%s.opml", user))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+		w.Header().Set("Cache-Control", "max-age=3600")
+		writeContentType("text/x-opml", w)
+		if err := writeOpml(doc, w); err != nil {
+			log.Error().Err(err).Msg("Unable to write subscriptions for user")
+		}
+	}
+}
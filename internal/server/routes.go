@@ -3,24 +3,51 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/RobBrazier/bookfeed/config"
-	"github.com/RobBrazier/bookfeed/internal/view/pages"
+	"github.com/RobBrazier/bookfeed/internal/feed"
 	"github.com/a-h/templ"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httprate"
 	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
 )
 
+var formats = func() (formats []string) {
+	for _, format := range feed.Formats {
+		formats = append(formats, string(format))
+	}
+	return formats
+}()
+
 func formatPath(path string) string {
-	formats := []string{"json", "atom", "rss"}
 	regex := strings.Join(formats, "|")
 	return fmt.Sprintf("%s.{format:(%s)}", path, regex)
 }
 
+type kindRoute struct {
+	path    string
+	handler func(s *Server, builder feed.Builder) http.HandlerFunc
+}
+
+var kindRoutes = map[feed.Kind]kindRoute{
+	feed.KIND_RECENT: {"/recent", (*Server).RecentHandler},
+	feed.KIND_AUTHOR: {"/author/{author:[a-zA-Z0-9-]+}", (*Server).AuthorHandler},
+	feed.KIND_SERIES: {"/series/{series:[a-zA-Z0-9-]+}", (*Server).SeriesHandler},
+	feed.KIND_USER:   {"/me/{username:[a-zA-Z0-9-]+}", (*Server).MeHandler},
+	feed.KIND_LIST: {
+		"/list/{username:[a-zA-Z0-9-]+}/{list:[a-zA-Z0-9-]+}",
+		(*Server).ListHandler,
+	},
+	feed.KIND_PUBLISHER: {"/publisher/{publisher:[a-zA-Z0-9-]+}", (*Server).PublisherHandler},
+	feed.KIND_GENRE:     {"/genre/{tag:[a-zA-Z0-9-]+}", (*Server).GenreHandler},
+	feed.KIND_MIX:       {"/mix", (*Server).MixHandler},
+}
+
 func (s *Server) RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
 
@@ -47,24 +74,82 @@ func (s *Server) RegisterRoutes() http.Handler {
 
 	MountStatic(r)
 
-	// redirect root to hardcover
-	r.Handle("/", http.RedirectHandler("/hc", http.StatusTemporaryRedirect))
+	providers := s.providers
+	if len(providers) > 0 {
+		// redirect root to the first registered provider (hardcover)
+		root := fmt.Sprintf("/%s", providers[0].Prefix)
+		r.Handle("/", http.RedirectHandler(root, http.StatusTemporaryRedirect))
+	}
 
 	r.Group(func(r chi.Router) {
 		r.Use(httprate.LimitByIP(10, 10*time.Second))
 
-		r.Route("/hc", func(r chi.Router) {
-			r.With(middleware.NoCache).Handle("/", templ.Handler(pages.Hardcover()))
-			r.Get(formatPath("/recent"), s.RecentHandler)
-			r.Get(formatPath("/author/{author:[a-zA-Z0-9-]+}"), s.AuthorHandler)
-			r.Get(formatPath("/series/{series:[a-zA-Z0-9-]+}"), s.SeriesHandler)
-			r.Get(formatPath("/me/{username:[a-zA-Z0-9-]+}"), s.MeHandler)
-		})
+		for _, provider := range providers {
+			r.Route(fmt.Sprintf("/%s", provider.Prefix), func(r chi.Router) {
+				if provider.Page != nil {
+					r.With(middleware.NoCache).Handle("/", templ.Handler(provider.Page))
+				}
+				if provider.builder == nil {
+					return
+				}
+				s.mountFeeds(r, provider)
+				r.Get("/search", s.SearchHandler(provider.builder))
+				if provider.ImportPage != nil {
+					r.With(middleware.NoCache).Get("/import", templ.Handler(provider.ImportPage).ServeHTTP)
+					r.Post("/import", s.ImportHandler(provider.Prefix, provider.builder))
+				}
+				if slices.Contains(provider.Kinds, feed.KIND_USER) {
+					path := kindRoutes[feed.KIND_USER].path + ".opml"
+					r.Get(path, s.OpmlHandler(provider.Prefix, provider.builder))
+				}
+			})
+		}
 
-		r.Route("/jnc", func(r chi.Router) {
-			r.With(middleware.NoCache).Handle("/", templ.Handler(pages.JNovelClub()))
-		})
+		r.Post("/f", s.SaveDefinitionHandler)
+		r.Get(savedFeedPath, s.SavedFeedHandler)
+		r.Post("/f/{id:[a-zA-Z0-9_-]+}/webhooks", s.RegisterWebhookHandler)
+		r.Delete("/f/{id:[a-zA-Z0-9_-]+}/webhooks/{webhook:[a-z0-9]+}", s.DeleteWebhookHandler)
+		r.Post("/f/{id:[a-zA-Z0-9_-]+}/digests", s.RegisterDigestHandler)
+		r.With(middleware.NoCache).
+			Get("/digests/{digest:[a-z0-9]+}/confirm", s.ConfirmDigestPageHandler)
+		r.Post("/digests/{digest:[a-z0-9]+}/confirm", s.ConfirmDigestHandler)
+		r.With(middleware.NoCache).
+			Get("/digests/{digest:[a-z0-9]+}/unsubscribe", s.UnsubscribeDigestPageHandler)
+		r.Post("/digests/{digest:[a-z0-9]+}/unsubscribe", s.UnsubscribeDigestHandler)
 	})
 
 	return r
 }
+
+var savedFeedPath = formatPath("/f/{id:[a-zA-Z0-9_-]+}")
+
+// mountFeeds adds a route for each kind of feed the provider supports
+func (s *Server) mountFeeds(r chi.Router, provider provider) {
+	for _, kind := range provider.Kinds {
+		route, ok := kindRoutes[kind]
+		if !ok {
+			log.Warn().
+				Str("provider", provider.Prefix).
+				Str("kind", string(kind)).
+				Msg("No route for feed kind")
+			continue
+		}
+		r.Get(formatPath(route.path), route.handler(s, provider.builder))
+	}
+}
+
+// feedRoutes serves just the feeds, without the middleware of RegisterRoutes,
+// for building feeds outside of a request
+func (s *Server) feedRoutes() http.Handler {
+	r := chi.NewRouter()
+	for _, provider := range s.providers {
+		if provider.builder == nil {
+			continue
+		}
+		r.Route(fmt.Sprintf("/%s", provider.Prefix), func(r chi.Router) {
+			s.mountFeeds(r, provider)
+		})
+	}
+	r.Get(savedFeedPath, s.SavedFeedHandler)
+	return r
+}
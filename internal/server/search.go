@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RobBrazier/bookfeed/internal/feed"
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	minSearchLength = 2
+	maxSearchLength = 100
+)
+
+type searchResponse struct {
+	Type    string               `json:"type"`
+	Query   string               `json:"query"`
+	Results []model.SearchResult `json:"results"`
+}
+
+// SearchHandler suggests authors or series matching a query, so their slugs
+// can be found without knowing them exactly
+func (s *Server) SearchHandler(builder feed.Builder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		kind := feed.Kind(strings.ToLower(query.Get("type")))
+		if kind == "" {
+			kind = feed.KIND_AUTHOR
+		}
+		if kind != feed.KIND_AUTHOR && kind != feed.KIND_SERIES {
+			s.badRequest(fmt.Errorf("type must be author or series"), w)
+			return
+		}
+		q := strings.TrimSpace(query.Get("q"))
+		if length := utf8.RuneCountInString(q); length < minSearchLength || length > maxSearchLength {
+			s.badRequest(
+				fmt.Errorf("q must be between %d and %d characters", minSearchLength, maxSearchLength),
+				w,
+			)
+			return
+		}
+		log := log.With().Str("type", string(kind)).Str("query", q).Logger()
+		results, err := builder.Search(r.Context(), kind, q)
+		if errors.Is(err, feed.ErrUnsupported) {
+			s.notFound(err, w)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("error searching")
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		writeContentType("application/json", w)
+		_ = json.NewEncoder(w).Encode(searchResponse{
+			Type:    string(kind),
+			Query:   q,
+			Results: append([]model.SearchResult{}, results...),
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,20 +11,55 @@ import (
 
 	"github.com/RobBrazier/bookfeed/config"
 	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/email"
 	"github.com/RobBrazier/bookfeed/internal/feed"
+	"github.com/RobBrazier/bookfeed/internal/httpclient"
 	"github.com/go-co-op/gocron/v2"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/maypok86/otter/v2"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	slogzerolog "github.com/samber/slog-zerolog/v2"
 )
 
 type Server struct {
-	port    int
-	logger  *zerolog.Logger
+	port      int
+	logger    *zerolog.Logger
+	providers []provider
+	client    *http.Client
+	// webhookClient only connects to public addresses, as anyone can
+	// register a webhook
+	webhookClient *http.Client
+	// mailer sends email digests, and is nil when SMTP or PUBLIC_URL isn't
+	// configured
+	mailer *email.Client
+	// published is when each feed last gained items, for WebSub
+	published *otter.Cache[string, publishedFeed]
+	// feeds serves the feed routes, to rebuild feeds outside of a request
+	feeds http.Handler
+	// caches hold the data loaded by the builders
+	caches *cache.Caches
+}
+
+type provider struct {
+	feed.Provider
 	builder feed.Builder
 }
 
+// newProviders creates the builder for each registered provider, sharing
+// deps. Providers without one only serve their pages
+func newProviders(deps feed.Deps) []provider {
+	var providers []provider
+	for _, registered := range feed.Providers() {
+		p := provider{Provider: registered}
+		if registered.NewBuilder != nil {
+			p.builder = registered.NewBuilder(deps)
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
 func getSlogLevel(level zerolog.Level) slog.Leveler {
 	switch level {
 	case zerolog.DebugLevel:
@@ -62,25 +98,83 @@ func getLogger() *zerolog.Logger {
 	return &logger
 }
 
+// refreshCache reloads data for feeds that are still being requested before
+// it expires, covering anything that would expire before the next run
+func (s *Server) refreshCache() {
+	interval := config.CacheRefreshInterval()
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+	if grown := s.caches.RefreshAhead(ctx, time.Now().Add(2*interval)); len(grown) > 0 {
+		s.republish(ctx)
+	}
+}
+
 func NewServer() *http.Server {
 	logger := getLogger()
 	port := config.Port()
 	log.Info().Int("port", port).Msg("Started server")
+
+	store, err := cache.OpenStore()
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to open cache store, caching in memory only")
+	}
+	caches := cache.NewCaches(store)
+	caches.HistoryDepth = config.FeedHistoryDepth()
+
+	NewServer := &Server{
+		port:          port,
+		logger:        logger,
+		providers:     newProviders(feed.Deps{Caches: caches, Now: time.Now}),
+		client:        httpclient.NewClient(nil),
+		webhookClient: httpclient.NewPublicClient(nil),
+		published:     newPublishedCache(),
+		caches:        caches,
+	}
+	NewServer.feeds = NewServer.feedRoutes()
+	if addr := config.SmtpAddr(); addr != "" && config.PublicUrl() == "" {
+		log.Warn().Msg("Email digests are disabled, set PUBLIC_URL for the links in them")
+	} else if addr != "" {
+		NewServer.mailer = email.NewClient(
+			addr,
+			config.SmtpUsername(),
+			config.SmtpPassword(),
+			config.SmtpFrom(),
+		)
+	}
+
 	scheduler, _ := gocron.NewScheduler()
-	_, err := scheduler.NewJob(
+	_, err = scheduler.NewJob(
 		gocron.DurationJob(1*time.Hour),
-		gocron.NewTask(cache.SaveCache),
+		gocron.NewTask(cache.SaveCache, caches),
 	)
 	if err != nil {
 		log.Error().Err(err).Msg("Unable to start scheduler")
 	}
-	scheduler.Start()
-
-	NewServer := &Server{
-		port:    port,
-		logger:  logger,
-		builder: feed.NewHardcoverBuilder(),
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(config.CacheRefreshInterval()),
+		gocron.NewTask(NewServer.refreshCache),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to schedule cache refresh")
 	}
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(config.WebhookInterval()),
+		gocron.NewTask(NewServer.deliverWebhooks),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to schedule webhook delivery")
+	}
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(1*time.Hour),
+		gocron.NewTask(NewServer.deliverDigests),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to schedule digest delivery")
+	}
+	scheduler.Start()
 
 	// Declare Server config
 	server := &http.Server{
@@ -95,9 +189,10 @@ func NewServer() *http.Server {
 		if err != nil {
 			log.Error().Err(err).Msg("Unable to shutdown scheduler")
 		}
+		caches.Close()
 	})
 
-	cache.LoadCache()
+	cache.LoadCache(caches)
 
 	return server
 }
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/httpclient"
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/RobBrazier/bookfeed/internal/webhook"
+	"github.com/gorilla/feeds"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxWebhooks limits how many webhooks can be registered across all feeds
+	maxWebhooks = 10_000
+	// maxWebhookFailures is how many deliveries in a row can fail before a
+	// webhook is removed, so receivers that are gone don't keep their place
+	maxWebhookFailures = 20
+	// webhookWorkers limits how many feeds are built, or deliveries made, at
+	// once
+	webhookWorkers = 8
+	// webhookTimeout limits each delivery, including its retries, so a slow
+	// receiver can't hold up the others
+	webhookTimeout = 30 * time.Second
+)
+
+type webhookRequest struct {
+	Url string `json:"url"`
+}
+
+type registeredWebhook struct {
+	Id     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+func (s *Server) RegisterWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	feedId := r.PathValue("id")
+	if _, ok := cache.GetDefinition(feedId); !ok {
+		s.notFound(fmt.Errorf("feed not found"), w)
+		return
+	}
+	var request webhookRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16*1024))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		s.badRequest(fmt.Errorf("invalid webhook: %w", err), w)
+		return
+	}
+	target, err := url.Parse(request.Url)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		s.badRequest(fmt.Errorf("webhook url must be an absolute http(s) url"), w)
+		return
+	}
+	// the address is checked again on delivery, as it may have changed
+	if err := httpclient.CheckPublicHost(r.Context(), target.Hostname()); err != nil {
+		s.badRequest(fmt.Errorf("webhook url must be on a public address: %w", err), w)
+		return
+	}
+	if cache.WebhookCount() >= maxWebhooks {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("webhook limit reached"))
+		return
+	}
+	id := strings.ToLower(rand.Text()[:12])
+	hook := model.Webhook{
+		Feed:    feedId,
+		Url:     target.String(),
+		Secret:  webhook.NewSecret(),
+		Created: time.Now().UTC(),
+	}
+	cache.SaveWebhook(id, hook)
+	log.Info().Str("feed", feedId).Str("webhook", id).Msg("Registered webhook")
+	writeContentType("application/json", w)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(registeredWebhook{Id: id, Secret: hook.Secret})
+}
+
+func (s *Server) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("webhook")
+	hook, ok := cache.GetWebhook(id)
+	if !ok || hook.Feed != r.PathValue("id") {
+		s.notFound(fmt.Errorf("webhook not found"), w)
+		return
+	}
+	secret, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(hook.Secret)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte("the webhook secret is required to delete it"))
+		return
+	}
+	cache.DeleteWebhook(id)
+	log.Info().Str("feed", hook.Feed).Str("webhook", id).Msg("Deleted webhook")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deliverWebhooks checks the saved feeds with webhooks for new items, and
+// sends them on. Failed deliveries are retried on the next run, until a
+// webhook has failed maxWebhookFailures times in a row
+func (s *Server) deliverWebhooks() {
+	ctx, cancel := context.WithTimeout(context.Background(), config.WebhookInterval())
+	defer cancel()
+
+	subscribers := make(map[string][]string)
+	webhooks := make(map[string]model.Webhook)
+	for id, hook := range cache.Webhooks() {
+		subscribers[hook.Feed] = append(subscribers[hook.Feed], id)
+		webhooks[id] = hook
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	log.Info().Int("feeds", len(subscribers)).Int("webhooks", len(webhooks)).Msg("Delivering webhooks")
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, webhookWorkers)
+
+	// each feed is built once, however many webhooks it has
+	built := make(map[string]*feeds.Feed)
+	for feedId := range subscribers {
+		wg.Go(func() {
+			workers <- struct{}{}
+			defer func() { <-workers }()
+			out, err := s.buildFeed(ctx, feedId)
+			if err != nil {
+				log.Error().Err(err).Str("feed", feedId).Msg("Unable to build feed for webhooks")
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			built[feedId] = &out.Feed
+		})
+	}
+	wg.Wait()
+
+	updated := make(map[string]model.Webhook)
+	for feedId, ids := range subscribers {
+		out, ok := built[feedId]
+		if !ok {
+			continue
+		}
+		for _, id := range ids {
+			wg.Go(func() {
+				workers <- struct{}{}
+				defer func() { <-workers }()
+				hook := s.deliverWebhook(ctx, id, webhooks[id], out)
+				mu.Lock()
+				defer mu.Unlock()
+				updated[id] = hook
+			})
+		}
+	}
+	wg.Wait()
+
+	for id, hook := range updated {
+		if hook.Failures >= maxWebhookFailures {
+			delete(updated, id)
+			cache.DeleteWebhook(id)
+			log.Warn().
+				Str("feed", hook.Feed).
+				Str("webhook", id).
+				Int("failures", hook.Failures).
+				Msg("Removed webhook after repeated failures")
+		}
+	}
+	cache.UpdateWebhooks(updated)
+}
+
+// deliverWebhook sends new items in the feed to a webhook, giving up after
+// webhookTimeout
+func (s *Server) deliverWebhook(
+	ctx context.Context,
+	id string,
+	hook model.Webhook,
+	out *feeds.Feed,
+) model.Webhook {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	hook, err := webhook.Deliver(ctx, s.webhookClient, id, hook, out, time.Now().UTC())
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("feed", hook.Feed).
+			Str("webhook", id).
+			Int("failures", hook.Failures).
+			Msg("Unable to deliver webhook")
+	}
+	return hook
+}
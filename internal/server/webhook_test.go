@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/RobBrazier/bookfeed/internal/cache"
+	"github.com/RobBrazier/bookfeed/internal/model"
+)
+
+// newWebhookServer creates a server delivering webhooks for a saved feed,
+// without checking receivers are on public addresses
+func newWebhookServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	t.Setenv("CACHE_STORAGE_PATH", t.TempDir())
+	if err := config.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newTestServer(newHardcoverClient(t))
+	s.webhookClient = &http.Client{}
+	return s, saveFeed(t)
+}
+
+// registerWebhook registers a webhook that has been checked before, so new
+// items are delivered to it
+func registerWebhook(t *testing.T, id, feedId, url string, failures int) {
+	t.Helper()
+	cache.SaveWebhook(id, model.Webhook{
+		Feed:     feedId,
+		Url:      url,
+		Secret:   "secret",
+		Created:  hcNow,
+		Checked:  hcNow,
+		Failures: failures,
+	})
+	t.Cleanup(func() { cache.DeleteWebhook(id) })
+}
+
+func TestDeliverWebhooksConcurrently(t *testing.T) {
+	s, feedId := newWebhookServer(t)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer slow.Close()
+	defer close(release)
+	received := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer fast.Close()
+	registerWebhook(t, "slow", feedId, slow.URL, 0)
+	registerWebhook(t, "fast", feedId, fast.URL, 0)
+
+	done := make(chan struct{})
+	go func() {
+		s.deliverWebhooks()
+		close(done)
+	}()
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a slow receiver not to hold up the others")
+	}
+	release <- struct{}{}
+	<-done
+
+	for _, id := range []string{"slow", "fast"} {
+		hook, _ := cache.GetWebhook(id)
+		if len(hook.Delivered) == 0 || hook.Failures != 0 {
+			t.Errorf("expected %s to be delivered, got %+v", id, hook)
+		}
+	}
+}
+
+func TestDeliverWebhooksRemovesFailingWebhooks(t *testing.T) {
+	s, feedId := newWebhookServer(t)
+	var requests atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	registerWebhook(t, "failing", feedId, failing.URL, 0)
+	registerWebhook(t, "dead", feedId, failing.URL, maxWebhookFailures-1)
+
+	s.deliverWebhooks()
+
+	if requests.Load() != 2 {
+		t.Errorf("expected both webhooks to be tried, got %d requests", requests.Load())
+	}
+	hook, ok := cache.GetWebhook("failing")
+	if !ok || hook.Failures != 1 || len(hook.Delivered) != 0 {
+		t.Errorf("expected the failure to be counted and the items kept for retry, got %+v", hook)
+	}
+	if _, ok := cache.GetWebhook("dead"); ok {
+		t.Errorf("expected the webhook to be removed after %d failures", maxWebhookFailures)
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/config"
+	"github.com/RobBrazier/bookfeed/internal/websub"
+	"github.com/gorilla/feeds"
+	"github.com/maypok86/otter/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// atomFeed adds the self and hub links to an Atom feed
+type atomFeed struct {
+	*feeds.AtomFeed
+	Links []feeds.AtomLink `xml:"link"`
+}
+
+func (f *atomFeed) FeedXml() any {
+	return f
+}
+
+type rssLink struct {
+	XMLName xml.Name `xml:"atom:link"`
+	Href    string   `xml:"href,attr"`
+	Rel     string   `xml:"rel,attr"`
+	Type    string   `xml:"type,attr,omitempty"`
+}
+
+type rssChannel struct {
+	*feeds.RssFeed
+	Links []rssLink
+}
+
+// rssFeed adds the self and hub links to a RSS feed, using atom:link elements
+type rssFeed struct {
+	XMLName          xml.Name `xml:"rss"`
+	Version          string   `xml:"version,attr"`
+	ContentNamespace string   `xml:"xmlns:content,attr"`
+	AtomNamespace    string   `xml:"xmlns:atom,attr"`
+	Channel          *rssChannel
+}
+
+func (f *rssFeed) FeedXml() any {
+	return f
+}
+
+// feedLinks are the WebSub discovery links for a feed
+type feedLinks struct {
+	self string
+	hub  string
+}
+
+func (l feedLinks) atom(out *feeds.Feed) *atomFeed {
+	feed := &atomFeed{AtomFeed: (&feeds.Atom{Feed: out}).AtomFeed()}
+	// the feed's own link would be hidden by Links
+	if out.Link != nil && out.Link.Href != "" {
+		feed.Links = append(feed.Links, feeds.AtomLink{Href: out.Link.Href, Rel: "alternate"})
+	}
+	if l.self != "" {
+		feed.Links = append(feed.Links, feeds.AtomLink{
+			Href: l.self,
+			Rel:  "self",
+			Type: "application/atom+xml",
+		})
+	}
+	if l.hub != "" {
+		feed.Links = append(feed.Links, feeds.AtomLink{Href: l.hub, Rel: "hub"})
+	}
+	return feed
+}
+
+func (l feedLinks) rss(out *feeds.Feed) *rssFeed {
+	channel := &rssChannel{RssFeed: (&feeds.Rss{Feed: out}).RssFeed()}
+	if l.self != "" {
+		channel.Links = append(channel.Links, rssLink{
+			Href: l.self,
+			Rel:  "self",
+			Type: "application/rss+xml",
+		})
+	}
+	if l.hub != "" {
+		channel.Links = append(channel.Links, rssLink{Href: l.hub, Rel: "hub"})
+	}
+	return &rssFeed{
+		Version:          "2.0",
+		ContentNamespace: "http://purl.org/rss/1.0/modules/content/",
+		AtomNamespace:    "http://www.w3.org/2005/Atom",
+		Channel:          channel,
+	}
+}
+
+// publishedFeed is the state of a feed that's been published to the hub
+type publishedFeed struct {
+	// Updated is when the newest item in the feed was first seen
+	Updated time.Time
+	// Url is where the feed was requested from, to rebuild it from
+	Url string
+}
+
+func newPublishedCache() *otter.Cache[string, publishedFeed] {
+	return otter.Must(&otter.Options[string, publishedFeed]{
+		MaximumSize:      10_000,
+		ExpiryCalculator: otter.ExpiryAccessing[string, publishedFeed](7 * 24 * time.Hour),
+	})
+}
+
+// baseUrl returns the public url of the server, falling back to the host the
+// request was made to. It's empty for requests made outside of the server
+func baseUrl(r *http.Request) string {
+	if public := publicBase(); public != "" {
+		return public
+	}
+	if r.Host == "" {
+		return ""
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+// publicBase is the url of the server set by PUBLIC_URL. Links that are sent
+// elsewhere - to the hub, or in emails - are only ever built from it, as the
+// request's Host and X-Forwarded-Proto headers are chosen by the client
+func publicBase() string {
+	return strings.TrimSuffix(config.PublicUrl(), "/")
+}
+
+// feedParams are the query parameters that change a feed. Others are left
+// out of topic urls, so they can't be used to publish the same feed again
+var feedParams = []string{
+	"since", "until", "window", "upcoming", "reminder", "format",
+	"filter", "imprints", "tags", "exclude", "author", "series", "genre",
+}
+
+// topicUrls returns the url of the feed in the format requested, followed by
+// its urls in the other formats. The key identifies the feed regardless of
+// format. Feeds only have topics when PUBLIC_URL is set
+func topicUrls(r *http.Request, format string) (key string, topics []string) {
+	base := publicBase()
+	if base == "" {
+		return "", nil
+	}
+	// saved feeds are served with a rewritten url, so prefer the original
+	requestUri := r.RequestURI
+	if requestUri == "" {
+		requestUri = r.URL.RequestURI()
+	}
+	uri, err := url.ParseRequestURI(requestUri)
+	if err != nil {
+		return "", nil
+	}
+	query := uri.Query()
+	normalised := url.Values{}
+	for _, param := range feedParams {
+		for _, value := range query[param] {
+			if value != "" {
+				normalised.Add(param, value)
+			}
+		}
+		slices.Sort(normalised[param])
+	}
+	uri.RawQuery = normalised.Encode()
+	uri.Path = path.Clean(uri.Path)
+	feedPath := strings.TrimSuffix(uri.Path, "."+format)
+	topics = []string{base + uri.RequestURI()}
+	for _, other := range formats {
+		if other != format {
+			uri.Path = fmt.Sprintf("%s.%s", feedPath, other)
+			topics = append(topics, base+uri.RequestURI())
+		}
+	}
+	uri.Path = feedPath
+	return uri.RequestURI(), topics
+}
+
+// feedUpdated returns when the newest item in the feed was first seen
+func feedUpdated(out *feeds.Feed) (updated time.Time) {
+	for _, item := range out.Items {
+		if item.Updated.After(updated) {
+			updated = item.Updated
+		}
+	}
+	return updated
+}
+
+// publish pings the configured hub when a feed gains items since it was last
+// served, so subscribers don't have to wait for their next poll
+func (s *Server) publish(key string, topics []string, out *feeds.Feed) {
+	hub := config.WebSubHub()
+	if hub == "" || len(topics) == 0 {
+		return
+	}
+	updated := feedUpdated(out)
+	previous, found := s.published.GetIfPresent(key)
+	if found && !updated.After(previous.Updated) {
+		return
+	}
+	s.published.Set(key, publishedFeed{Updated: updated, Url: topics[0]})
+	if !found {
+		// nothing to compare against (e.g. after a restart)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		log := log.With().Str("hub", hub).Strs("topics", topics).Logger()
+		if err := websub.Publish(ctx, s.client, hub, topics...); err != nil {
+			log.Error().Err(err).Msg("Unable to publish to hub")
+			return
+		}
+		log.Info().Msg("Published feed update to hub")
+	}()
+}
+
+// republish rebuilds the feeds that have been published to the hub, so new
+// items loaded in the background are published without waiting for someone
+// to request the feed. Feeds are only published if they gained items
+func (s *Server) republish(ctx context.Context) {
+	if config.WebSubHub() == "" || publicBase() == "" {
+		return
+	}
+	for key, published := range s.published.All() {
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, published.Url, nil)
+		if err != nil {
+			continue
+		}
+		// keep the topic urls the same as when the feed was requested, as
+		// saved feeds rewrite the url
+		r.RequestURI = r.URL.RequestURI()
+		capture := &feedCapture{header: http.Header{}}
+		s.feeds.ServeHTTP(capture, r)
+		if capture.feed == nil {
+			log.Warn().
+				Str("feed", key).
+				Int("status", capture.status).
+				Msg("Unable to rebuild feed to publish")
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
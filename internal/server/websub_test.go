@@ -0,0 +1,156 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/RobBrazier/bookfeed/config"
+)
+
+// useWebSub configures the hub, and the public url feeds are published from
+func useWebSub(t *testing.T, publicUrl string) {
+	t.Helper()
+	t.Setenv("PUBLIC_URL", publicUrl)
+	t.Setenv("WEBSUB_HUB", "https://hub.example.com/")
+	if err := config.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTopicUrls(t *testing.T) {
+	tests := []struct {
+		name      string
+		publicUrl string
+		target    string
+		format    string
+		key       string
+		// topics are some of the topics expected, the first being the url
+		// of the format requested
+		topics []string
+	}{
+		{
+			name:   "without a public url",
+			target: "/hc/author/brandon-sanderson.atom",
+			format: "atom",
+		},
+		{
+			name:      "public url",
+			publicUrl: "https://bookfeed.example.com/",
+			target:    "/hc/author/brandon-sanderson.atom",
+			format:    "atom",
+			key:       "/hc/author/brandon-sanderson",
+			topics: []string{
+				"https://bookfeed.example.com/hc/author/brandon-sanderson.atom",
+				"https://bookfeed.example.com/hc/author/brandon-sanderson.rss",
+			},
+		},
+		{
+			name:      "unknown parameters are dropped",
+			publicUrl: "https://bookfeed.example.com",
+			target:    "/hc/mix.rss?series=b&cachebust=1&author=a&since=&author=0",
+			format:    "rss",
+			key:       "/hc/mix?author=0&author=a&series=b",
+			topics: []string{
+				"https://bookfeed.example.com/hc/mix.rss?author=0&author=a&series=b",
+				"https://bookfeed.example.com/hc/mix.atom?author=0&author=a&series=b",
+			},
+		},
+		{
+			name:      "path is cleaned",
+			publicUrl: "https://bookfeed.example.com",
+			target:    "/hc//author/./brandon-sanderson.atom?format=audio",
+			format:    "atom",
+			key:       "/hc/author/brandon-sanderson?format=audio",
+			topics: []string{
+				"https://bookfeed.example.com/hc/author/brandon-sanderson.atom?format=audio",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useWebSub(t, test.publicUrl)
+			r := httptest.NewRequest(http.MethodGet, test.target, nil)
+			r.Host = "attacker.example.com"
+			r.Header.Set("X-Forwarded-Proto", "gopher")
+			key, topics := topicUrls(r, test.format)
+			if key != test.key {
+				t.Errorf("expected key %q, got %q", test.key, key)
+			}
+			if len(test.topics) > 0 && (len(topics) == 0 || topics[0] != test.topics[0]) {
+				t.Errorf("expected the first topic to be %q, got %q", test.topics[0], topics)
+			}
+			for _, topic := range test.topics {
+				if !slices.Contains(topics, topic) {
+					t.Errorf("expected topic %q, got %q", topic, topics)
+				}
+			}
+			if test.topics == nil && topics != nil {
+				t.Errorf("expected no topics, got %q", topics)
+			}
+		})
+	}
+}
+
+func TestFeedsNotPublishedWithoutPublicUrl(t *testing.T) {
+	useWebSub(t, "")
+	s, _ := newTestServer(newHardcoverClient(t))
+	routes := s.feedRoutes()
+
+	r := httptest.NewRequest(http.MethodGet, "/hc/author/brandon-sanderson.atom", nil)
+	r.Host = "attacker.example.com"
+	w := httptest.NewRecorder()
+	routes.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if links := w.Header().Values("Link"); len(links) > 0 {
+		t.Errorf("expected no self or hub links, got %q", links)
+	}
+	if size := s.published.EstimatedSize(); size != 0 {
+		t.Errorf("expected nothing to be published, got %d feeds", size)
+	}
+}
+
+func TestPublishedKeyedOnFeed(t *testing.T) {
+	useWebSub(t, "https://bookfeed.example.com")
+	s, _ := newTestServer(newHardcoverClient(t))
+	routes := s.feedRoutes()
+
+	for _, path := range []string{
+		"/hc/author/brandon-sanderson.atom?since=P1Y",
+		"/hc/author/brandon-sanderson.rss?since=P1Y&utm_source=reader",
+		"/hc/author/brandon-sanderson.json?nonce=1&since=P1Y",
+	} {
+		if w := getFeed(routes, path); w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body)
+		}
+	}
+	key := "/hc/author/brandon-sanderson?since=P1Y"
+	published, ok := s.published.GetIfPresent(key)
+	if !ok || s.published.EstimatedSize() != 1 {
+		t.Fatalf("expected only %s to be published, got %d feeds", key, s.published.EstimatedSize())
+	}
+	want := "https://bookfeed.example.com/hc/author/brandon-sanderson.atom?since=P1Y"
+	if published.Url != want {
+		t.Errorf("expected the feed to be rebuilt from %s, got %s", want, published.Url)
+	}
+}
+
+func TestRecentFailureNotServed(t *testing.T) {
+	useWebSub(t, "https://bookfeed.example.com")
+	// the client has no response for recent releases, so they fail
+	s, _ := newTestServer(newHardcoverClient(t))
+
+	w := getFeed(s.feedRoutes(), "/hc/recent.atom")
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected 502, got %d: %s", w.Code, w.Body)
+	}
+	if cacheControl := w.Header().Get("Cache-Control"); cacheControl != "" {
+		t.Errorf("expected the failure not to be cached, got %q", cacheControl)
+	}
+	if size := s.published.EstimatedSize(); size != 0 {
+		t.Errorf("expected nothing to be published, got %d feeds", size)
+	}
+}
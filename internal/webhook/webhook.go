@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/gorilla/feeds"
+)
+
+const (
+	SignatureHeader = "X-Bookfeed-Signature"
+	EventHeader     = "X-Bookfeed-Event"
+)
+
+type Payload struct {
+	Feed  Feed   `json:"feed"`
+	Items []Item `json:"items"`
+}
+
+type Feed struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
+}
+
+type Item struct {
+	Id        string    `json:"id"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	Author    string    `json:"author,omitempty"`
+	Image     string    `json:"image,omitempty"`
+	Content   string    `json:"content"`
+	Published time.Time `json:"published"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// NewSecret generates a secret used to sign deliveries to a webhook
+func NewSecret() string {
+	return rand.Text()
+}
+
+// Sign returns the signature of a delivery, as sent in the SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a delivery, for use by receivers
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func newItem(item *feeds.Item) Item {
+	result := Item{
+		Id:        item.Id,
+		Title:     item.Title,
+		Content:   item.Content,
+		Published: item.Created,
+		FirstSeen: item.Updated,
+	}
+	if item.Link != nil {
+		result.Link = item.Link.Href
+	}
+	if item.Author != nil {
+		result.Author = item.Author.Name
+	}
+	if item.Enclosure != nil {
+		result.Image = item.Enclosure.Url
+	}
+	return result
+}
+
+// NewItems returns the items in the feed that haven't been delivered yet,
+// oldest first
+func NewItems(feed *feeds.Feed, delivered []string) []Item {
+	var items []Item
+	for _, item := range feed.Items {
+		if !slices.Contains(delivered, item.Id) {
+			items = append(items, newItem(item))
+		}
+	}
+	slices.Reverse(items)
+	return items
+}
+
+// Send POSTs the payload to the webhook, signed with its secret. Retries are
+// left to the client
+func Send(ctx context.Context, client *http.Client, webhook model.Webhook, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, "items")
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// Deliver sends any new items in the feed to the webhook, and returns the
+// webhook updated with what was delivered, or with the failure counted. The
+// first check of a webhook only records the items already in the feed
+func Deliver(
+	ctx context.Context,
+	client *http.Client,
+	id string,
+	webhook model.Webhook,
+	feed *feeds.Feed,
+	now time.Time,
+) (model.Webhook, error) {
+	items := NewItems(feed, webhook.Delivered)
+	if !webhook.Checked.IsZero() && len(items) > 0 {
+		payload := Payload{
+			Feed: Feed{
+				Id:    webhook.Feed,
+				Title: feed.Title,
+			},
+			Items: items,
+		}
+		if feed.Link != nil {
+			payload.Feed.Link = feed.Link.Href
+		}
+		if err := Send(ctx, client, webhook, payload); err != nil {
+			webhook.Failures++
+			return webhook, fmt.Errorf("delivery to webhook %s failed: %w", id, err)
+		}
+	}
+	// only the items still in the feed need remembering
+	delivered := make([]string, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		delivered = append(delivered, item.Id)
+	}
+	webhook.Delivered = delivered
+	webhook.Checked = now
+	webhook.Failures = 0
+	return webhook, nil
+}
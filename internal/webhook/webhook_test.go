@@ -0,0 +1,275 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RobBrazier/bookfeed/internal/model"
+	"github.com/gorilla/feeds"
+)
+
+// delivery is a request received by a receiver
+type delivery struct {
+	body      []byte
+	signature string
+	event     string
+	payload   Payload
+}
+
+// receiver is a webhook endpoint that responds with each status in turn,
+// then with 204 No Content
+type receiver struct {
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []delivery
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	received := delivery{
+		body:      body,
+		signature: req.Header.Get(SignatureHeader),
+		event:     req.Header.Get(EventHeader),
+	}
+	_ = json.Unmarshal(body, &received.payload)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, received)
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) received() []delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.deliveries)
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	t.Helper()
+	receiver := &receiver{statuses: statuses}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	return receiver, server
+}
+
+// newFeed creates a feed with an item for each id, newest first
+func newFeed(ids ...string) *feeds.Feed {
+	feed := &feeds.Feed{
+		Title: "Hardcover Author Releases: Brandon Sanderson",
+		Link:  &feeds.Link{Href: "https://hardcover.app/authors/brandon-sanderson"},
+	}
+	published := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range ids {
+		feed.Add(&feeds.Item{
+			Id:      id,
+			Title:   "Book " + id,
+			Link:    &feeds.Link{Href: "https://hardcover.app/books/" + id},
+			Author:  &feeds.Author{Name: "Brandon Sanderson"},
+			Created: published.AddDate(0, 0, -i),
+		})
+	}
+	return feed
+}
+
+func itemIds(items []Item) []string {
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, item.Id)
+	}
+	return ids
+}
+
+var checked = time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestDeliver(t *testing.T) {
+	tests := []struct {
+		name      string
+		checked   time.Time
+		delivered []string
+		feed      []string
+		// sent is the items expected to be delivered, or nil for no request
+		sent []string
+	}{
+		{
+			name: "first check only records items",
+			feed: []string{"3", "2", "1"},
+		},
+		{
+			name:      "new items oldest first",
+			checked:   checked,
+			delivered: []string{"2", "1"},
+			feed:      []string{"4", "3", "2", "1"},
+			sent:      []string{"3", "4"},
+		},
+		{
+			name:      "nothing new",
+			checked:   checked,
+			delivered: []string{"2", "1"},
+			feed:      []string{"2", "1"},
+		},
+		{
+			name:      "items dropped from the feed are forgotten",
+			checked:   checked,
+			delivered: []string{"3", "2", "1"},
+			feed:      []string{"4", "3"},
+			sent:      []string{"4"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receiver, server := newReceiver(t)
+			hook := model.Webhook{
+				Feed:      "OBy3enVB",
+				Url:       server.URL,
+				Secret:    NewSecret(),
+				Checked:   test.checked,
+				Delivered: test.delivered,
+			}
+			now := checked.Add(15 * time.Minute)
+			updated, err := Deliver(
+				context.Background(),
+				server.Client(),
+				"webhook",
+				hook,
+				newFeed(test.feed...),
+				now,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deliveries := receiver.received()
+			switch {
+			case test.sent == nil && len(deliveries) > 0:
+				ids := itemIds(deliveries[0].payload.Items)
+				t.Errorf("expected nothing to be sent, got %q", ids)
+			case test.sent != nil && len(deliveries) != 1:
+				t.Errorf("expected 1 delivery, got %d", len(deliveries))
+			case test.sent != nil:
+				if ids := itemIds(deliveries[0].payload.Items); !slices.Equal(ids, test.sent) {
+					t.Errorf("expected items %q to be sent, got %q", test.sent, ids)
+				}
+			}
+			if !slices.Equal(updated.Delivered, test.feed) {
+				t.Errorf(
+					"expected %q to be recorded as delivered, got %q",
+					test.feed,
+					updated.Delivered,
+				)
+			}
+			if !updated.Checked.Equal(now) {
+				t.Errorf("expected checked at %s, got %s", now, updated.Checked)
+			}
+		})
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	receiver, server := newReceiver(t)
+	hook := model.Webhook{
+		Feed:      "OBy3enVB",
+		Url:       server.URL,
+		Secret:    NewSecret(),
+		Checked:   checked,
+		Delivered: []string{"1"},
+	}
+	_, err := Deliver(
+		context.Background(),
+		server.Client(),
+		"webhook",
+		hook,
+		newFeed("2", "1"),
+		checked,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries := receiver.received()
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(deliveries))
+	}
+	received := deliveries[0]
+	if !Verify(hook.Secret, received.body, received.signature) {
+		t.Errorf("signature %q doesn't match the body", received.signature)
+	}
+	if Verify(NewSecret(), received.body, received.signature) {
+		t.Error("expected the signature to only match the webhook's secret")
+	}
+	if received.event != "items" {
+		t.Errorf("expected an items event, got %q", received.event)
+	}
+	want := Feed{
+		Id:    "OBy3enVB",
+		Title: "Hardcover Author Releases: Brandon Sanderson",
+		Link:  "https://hardcover.app/authors/brandon-sanderson",
+	}
+	if received.payload.Feed != want {
+		t.Errorf("expected feed %+v, got %+v", want, received.payload.Feed)
+	}
+	item := received.payload.Items[0]
+	if item.Link != "https://hardcover.app/books/2" || item.Author != "Brandon Sanderson" {
+		t.Errorf("unexpected item %+v", item)
+	}
+}
+
+func TestDeliverRetriesFailures(t *testing.T) {
+	receiver, server := newReceiver(t, http.StatusInternalServerError)
+	hook := model.Webhook{
+		Feed:      "OBy3enVB",
+		Url:       server.URL,
+		Secret:    NewSecret(),
+		Checked:   checked,
+		Delivered: []string{"1"},
+	}
+	feed := newFeed("2", "1")
+
+	failed, err := Deliver(context.Background(), server.Client(), "webhook", hook, feed, checked)
+	if err == nil {
+		t.Fatal("expected the failed delivery to return an error")
+	}
+	if !slices.Equal(failed.Delivered, hook.Delivered) || !failed.Checked.Equal(checked) {
+		t.Errorf("expected a failed delivery to leave the webhook unchanged, got %+v", failed)
+	}
+	if failed.Failures != 1 {
+		t.Errorf("expected the failure to be counted, got %d", failed.Failures)
+	}
+
+	// the next check sends the same items again
+	retried, err := Deliver(
+		context.Background(),
+		server.Client(),
+		"webhook",
+		failed,
+		feed,
+		checked.Add(15*time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliveries := receiver.received()
+	if len(deliveries) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", len(deliveries))
+	}
+	for i, received := range deliveries {
+		if ids := itemIds(received.payload.Items); !slices.Equal(ids, []string{"2"}) {
+			t.Errorf("delivery %d: expected item 2, got %q", i, ids)
+		}
+	}
+	if !slices.Equal(retried.Delivered, []string{"2", "1"}) {
+		t.Errorf("expected both items to be recorded as delivered, got %q", retried.Delivered)
+	}
+	if retried.Failures != 0 {
+		t.Errorf("expected a delivery to reset the failures, got %d", retried.Failures)
+	}
+}
@@ -0,0 +1,40 @@
+package websub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Publish notifies a hub that the topics have been updated, so it can fetch
+// them and distribute the changes to subscribers
+func Publish(ctx context.Context, client *http.Client, hub string, topics ...string) error {
+	form := url.Values{}
+	form.Set("hub.mode", "publish")
+	for _, topic := range topics {
+		form.Add("hub.url", topic)
+	}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		hub,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("hub responded with %s", resp.Status)
+	}
+	return nil
+}